@@ -40,12 +40,16 @@ func (p *Program) Literal() string {
 type VariableDecl struct {
 	Name  *LocalVarName
 	Token token.Token // the token.LET token.
+	Type  *TypeName   // the annotation after the name, or nil.
 	Value Expression
 }
 
 func (v *VariableDecl) StatementNode()  {}
 func (v *VariableDecl) Literal() string { return v.Token.Literal }
 
+// Doc returns the doc comment written before the declaration.
+func (v *VariableDecl) Doc() string { return v.Token.Doc }
+
 // LocalVarName represents a local variable name.
 type LocalVarName struct {
 	Token token.Token // the token.IDENT token.
@@ -53,3 +57,12 @@ type LocalVarName struct {
 }
 
 func (l *LocalVarName) Literal() string { return l.Token.Literal }
+
+// TypeName represents a type annotation, as in let x: int = 5. The
+// evaluator ignores it.
+type TypeName struct {
+	Token token.Token // the token.IDENT token.
+	Value string
+}
+
+func (t *TypeName) Literal() string { return t.Token.Literal }
@@ -0,0 +1,98 @@
+// Command monkey-lsp is a Language Server Protocol server for Monkey.
+//
+// It speaks JSON-RPC over stdin and stdout. Documents are kept in sync
+// incrementally and lexical errors are published as diagnostics.
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/textproto"
+	"os"
+	"strconv"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("monkey-lsp: ")
+	s := newServer(newConn(os.Stdin, os.Stdout))
+	os.Exit(s.serve())
+}
+
+// A message is a JSON-RPC request, response or notification.
+type message struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id,omitempty"`
+	Method  string           `json:"method,omitempty"`
+	Params  json.RawMessage  `json:"params,omitempty"`
+	Result  interface{}      `json:"result,omitempty"`
+	Error   *responseError   `json:"error,omitempty"`
+}
+
+// A responseError is the error of a failed request.
+type responseError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// JSON-RPC error codes.
+const (
+	errParse          = -32700
+	errMethodNotFound = -32601
+	errInvalidParams  = -32602
+)
+
+// maxMessageSize is the largest message body read, in bytes, so that a
+// corrupt header cannot make the server allocate without bound.
+const maxMessageSize = 64 << 20
+
+// A conn reads and writes messages framed with LSP Content-Length headers.
+type conn struct {
+	r *textproto.Reader
+	w io.Writer
+}
+
+func newConn(r io.Reader, w io.Writer) *conn {
+	return &conn{r: textproto.NewReader(bufio.NewReader(r)), w: w}
+}
+
+// read returns the next message.
+func (c *conn) read() (*message, error) {
+	header, err := c.r.ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid Content-Length: %v", err)
+	}
+	if length < 0 || length > maxMessageSize {
+		// The stream cannot be resynchronized after a bad frame.
+		return nil, fmt.Errorf("invalid Content-Length: %d not in [0, %d]", length, maxMessageSize)
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(c.r.R, body); err != nil {
+		return nil, err
+	}
+	var msg message
+	if err := json.Unmarshal(body, &msg); err != nil {
+		return nil, &responseError{Code: errParse, Message: err.Error()}
+	}
+	return &msg, nil
+}
+
+// write sends msg.
+func (c *conn) write(msg *message) error {
+	msg.JSONRPC = "2.0"
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(c.w, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	return err
+}
+
+func (e *responseError) Error() string { return e.Message }
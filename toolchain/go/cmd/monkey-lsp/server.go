@@ -0,0 +1,236 @@
+package main
+
+import (
+	"encoding/json"
+	"github/com/styvane/monkey/diagnostics"
+	"github/com/styvane/monkey/lexer"
+	"github/com/styvane/monkey/token"
+	"io"
+	"log"
+)
+
+// A document is an open text document and its tokens.
+type document struct {
+	text   []rune
+	tokens []token.Token
+}
+
+func newDocument(text string) *document {
+	return &document{text: []rune(text), tokens: lexer.Tokenize(text)}
+}
+
+// apply applies a content change, relexing only the edited region.
+func (d *document) apply(change contentChange) {
+	if change.Range == nil {
+		*d = *newDocument(change.Text)
+		return
+	}
+	edit := lexer.Edit{
+		Start: d.offset(change.Range.Start),
+		End:   d.offset(change.Range.End),
+		Text:  change.Text,
+	}
+	if edit.End < edit.Start {
+		edit.End = edit.Start
+	}
+	text := string(d.text[:edit.Start]) + edit.Text + string(d.text[edit.End:])
+	d.tokens = lexer.Relex(text, d.tokens, edit)
+	d.text = []rune(text)
+}
+
+// offset converts an LSP position to a rune offset, clamping it to the
+// end of its line.
+func (d *document) offset(pos position) int {
+	i := 0
+	for line := 0; line < pos.Line && i < len(d.text); i++ {
+		if d.text[i] == '\n' {
+			line += 1
+		}
+	}
+	for units := 0; i < len(d.text) && d.text[i] != '\n'; i++ {
+		units += utf16Len(d.text[i])
+		if units > pos.Character {
+			break
+		}
+	}
+	return i
+}
+
+// position converts a rune offset to an LSP position.
+func (d *document) position(offset int) position {
+	var pos position
+	for _, ch := range d.text[:offset] {
+		if ch == '\n' {
+			pos.Line += 1
+			pos.Character = 0
+		} else {
+			pos.Character += utf16Len(ch)
+		}
+	}
+	return pos
+}
+
+// diagnostics returns the lexical errors in the document.
+func (d *document) diagnostics() []diagnostic {
+	diags := []diagnostic{}
+	for _, tok := range d.tokens {
+		diag, ok := lexer.Diagnose(tok)
+		if !ok {
+			continue
+		}
+		end := diag.Span.Offset + diag.Length
+		if end > len(d.text) {
+			end = len(d.text)
+		}
+		diags = append(diags, diagnostic{
+			Range:    lspRange{Start: d.position(diag.Span.Offset), End: d.position(end)},
+			Severity: lspSeverity(diag.Severity),
+			Code:     diag.Code,
+			Source:   "monkey",
+			Message:  diag.Message,
+		})
+	}
+	return diags
+}
+
+// lspSeverity converts a diagnostic severity to its LSP value.
+func lspSeverity(s diagnostics.Severity) int {
+	switch s {
+	case diagnostics.Warning:
+		return severityWarning
+	case diagnostics.Note:
+		return severityInformation
+	default:
+		return severityError
+	}
+}
+
+// utf16Len returns the number of UTF-16 code units encoding ch.
+func utf16Len(ch rune) int {
+	if ch >= 0x10000 {
+		return 2
+	}
+	return 1
+}
+
+// A server handles the LSP messages of one client.
+type server struct {
+	conn     *conn
+	docs     map[string]*document
+	shutdown bool
+}
+
+func newServer(c *conn) *server {
+	return &server{conn: c, docs: make(map[string]*document)}
+}
+
+// serve handles messages until the client exits and returns the exit
+// code required by the protocol.
+func (s *server) serve() int {
+	for {
+		msg, err := s.conn.read()
+		if err == io.EOF {
+			return 1
+		}
+		if err != nil {
+			if rerr, ok := err.(*responseError); ok {
+				s.reply(nil, nil, rerr)
+				continue
+			}
+			log.Print(err)
+			return 1
+		}
+		if msg.Method == "exit" {
+			if s.shutdown {
+				return 0
+			}
+			return 1
+		}
+		s.handle(msg)
+	}
+}
+
+// handle dispatches a request or notification.
+func (s *server) handle(msg *message) {
+	var err error
+	switch msg.Method {
+	case "initialize":
+		s.reply(msg.ID, initializeResult{
+			Capabilities: serverCapabilities{TextDocumentSync: syncIncremental},
+			ServerInfo:   serverInfo{Name: "monkey-lsp"},
+		}, nil)
+		return
+	case "shutdown":
+		s.shutdown = true
+		s.reply(msg.ID, nil, nil)
+		return
+	case "textDocument/didOpen":
+		var params didOpenParams
+		if err = json.Unmarshal(msg.Params, &params); err == nil {
+			doc := newDocument(params.TextDocument.Text)
+			s.docs[params.TextDocument.URI] = doc
+			s.publish(params.TextDocument.URI, doc)
+		}
+	case "textDocument/didChange":
+		var params didChangeParams
+		if err = json.Unmarshal(msg.Params, &params); err == nil {
+			doc, ok := s.docs[params.TextDocument.URI]
+			if !ok {
+				doc = newDocument("")
+				s.docs[params.TextDocument.URI] = doc
+			}
+			for _, change := range params.ContentChanges {
+				doc.apply(change)
+			}
+			s.publish(params.TextDocument.URI, doc)
+		}
+	case "textDocument/didClose":
+		var params didCloseParams
+		if err = json.Unmarshal(msg.Params, &params); err == nil {
+			delete(s.docs, params.TextDocument.URI)
+			s.notify("textDocument/publishDiagnostics",
+				publishDiagnosticsParams{URI: params.TextDocument.URI, Diagnostics: []diagnostic{}})
+		}
+	default:
+		if msg.ID != nil {
+			s.reply(msg.ID, nil, &responseError{Code: errMethodNotFound, Message: "method not found: " + msg.Method})
+		}
+		return
+	}
+	if err != nil && msg.ID != nil {
+		s.reply(msg.ID, nil, &responseError{Code: errInvalidParams, Message: err.Error()})
+	}
+}
+
+// publish sends the diagnostics of doc.
+func (s *server) publish(uri string, doc *document) {
+	s.notify("textDocument/publishDiagnostics",
+		publishDiagnosticsParams{URI: uri, Diagnostics: doc.diagnostics()})
+}
+
+func (s *server) reply(id *json.RawMessage, result interface{}, err *responseError) {
+	if id == nil {
+		null := json.RawMessage("null")
+		id = &null
+	}
+	msg := &message{ID: id, Result: result, Error: err}
+	if result == nil && err == nil {
+		msg.Result = json.RawMessage("null")
+	}
+	s.write(msg)
+}
+
+func (s *server) notify(method string, params interface{}) {
+	raw, err := json.Marshal(params)
+	if err != nil {
+		log.Print(err)
+		return
+	}
+	s.write(&message{Method: method, Params: raw})
+}
+
+func (s *server) write(msg *message) {
+	if err := s.conn.write(msg); err != nil {
+		log.Print(err)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestServerDiagnostics(t *testing.T) {
+	var in bytes.Buffer
+	send := func(id int, method string, params string) {
+		body := fmt.Sprintf(`{"jsonrpc":"2.0","method":%q,"params":%s`, method, params)
+		if id > 0 {
+			body += fmt.Sprintf(`,"id":%d`, id)
+		}
+		body += "}"
+		fmt.Fprintf(&in, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	}
+	send(1, "initialize", `{}`)
+	send(0, "textDocument/didOpen", `{"textDocument":{"uri":"file:///a.mk","text":"let x = 5;\nlet 😀 = @;"}}`)
+	send(0, "textDocument/didChange", `{"textDocument":{"uri":"file:///a.mk"},"contentChanges":[
+		{"range":{"start":{"line":1,"character":9},"end":{"line":1,"character":10}},"text":"\"abc"}]}`)
+	send(0, "textDocument/didChange", `{"textDocument":{"uri":"file:///a.mk"},"contentChanges":[{"text":"let y = 1;"}]}`)
+	send(2, "shutdown", `null`)
+	send(0, "exit", `null`)
+
+	var out bytes.Buffer
+	s := newServer(newConn(&in, &out))
+	if code := s.serve(); code != 0 {
+		t.Fatalf("exit code wrong. expected=0, got=%d", code)
+	}
+
+	var published [][]diagnostic
+	c := newConn(&out, io.Discard)
+	for {
+		msg, err := c.read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg.Method != "textDocument/publishDiagnostics" {
+			continue
+		}
+		var params publishDiagnosticsParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			t.Fatal(err)
+		}
+		published = append(published, params.Diagnostics)
+	}
+
+	expected := [][]diagnostic{
+		{{lspRange{position{1, 4}, position{1, 6}}, severityError, "illegal-character", "monkey", `illegal character "😀"`},
+			{lspRange{position{1, 9}, position{1, 10}}, severityError, "illegal-character", "monkey", `illegal character "@"`}},
+		{{lspRange{position{1, 4}, position{1, 6}}, severityError, "illegal-character", "monkey", `illegal character "😀"`},
+			{lspRange{position{1, 9}, position{1, 14}}, severityError, "unterminated-string", "monkey", "unterminated string"}},
+		{},
+	}
+	if len(published) != len(expected) {
+		t.Fatalf("published diagnostics wrong. expected=%d notifications, got=%+v", len(expected), published)
+	}
+	for i := range expected {
+		if fmt.Sprint(published[i]) != fmt.Sprint(expected[i]) {
+			t.Errorf("notification[%d] wrong.\nexpected=%+v\ngot=%+v", i, expected[i], published[i])
+		}
+	}
+}
+
+func TestReadContentLength(t *testing.T) {
+	tests := []struct {
+		input       string
+		expectedErr bool
+	}{
+		{"Content-Length: 2\r\n\r\n{}", false},
+		{"Content-Length: -1\r\n\r\n{}", true},
+		{"Content-Length: x\r\n\r\n{}", true},
+		{fmt.Sprintf("Content-Length: %d\r\n\r\n{}", maxMessageSize+1), true},
+		{"Content-Length: 99999999999999999999\r\n\r\n{}", true},
+	}
+
+	for i, tt := range tests {
+		_, err := newConn(strings.NewReader(tt.input), io.Discard).read()
+		if (err != nil) != tt.expectedErr {
+			t.Errorf("tests[%d] - read(%q) error wrong. expected error=%t, got=%v",
+				i, tt.input, tt.expectedErr, err)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github/com/styvane/monkey/lexer"
+	"github/com/styvane/monkey/token"
+	"io"
+	"strings"
+)
+
+// A binding is a documented top-level let declaration.
+type binding struct {
+	name      string
+	signature string // e.g. "let add = fn(a, b)".
+	doc       string
+}
+
+func runDoc(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("doc", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	format := flags.String("format", "text", "output format: text or markdown")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: monkey doc [-format=text|markdown] file.mk (use - for stdin)")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return parseExitCode(err)
+	}
+	if flags.NArg() != 1 || (*format != "text" && *format != "markdown") {
+		flags.Usage()
+		return exitUsage
+	}
+
+	src, err := readSource(flags.Arg(0), stdin)
+	if err != nil {
+		fmt.Fprintf(stderr, "monkey: %v\n", err)
+		return exitError
+	}
+	bindings := exportedBindings(lexer.Tokenize(string(src)))
+	if *format == "markdown" {
+		writeMarkdown(stdout, bindings)
+	} else {
+		writeText(stdout, bindings)
+	}
+	return exitOK
+}
+
+// exportedBindings returns the let declarations at the top level of a
+// module whose name does not start with an underscore. It works on the
+// tokens, so that a file the parser would reject can still be
+// documented.
+func exportedBindings(toks []token.Token) []binding {
+	var bindings []binding
+	depth := 0
+	for i, tok := range toks {
+		switch tok.Kind {
+		case token.LPAREN, token.LBRACE, token.LBRACKET:
+			depth += 1
+		case token.RPAREN, token.RBRACE, token.RBRACKET:
+			depth -= 1
+		case token.LET:
+			if depth != 0 || i+1 >= len(toks) || toks[i+1].Kind != token.IDENT {
+				continue
+			}
+			name := toks[i+1].Literal
+			if strings.HasPrefix(name, "_") {
+				continue
+			}
+			bindings = append(bindings, binding{name, signature(toks[i+1:]), tok.Doc})
+		}
+	}
+	return bindings
+}
+
+// signature returns the declaration starting at the name token, up to
+// the parameters if the value is a function literal. Type annotations
+// of the parameters are left out.
+func signature(toks []token.Token) string {
+	sig := "let " + toks[0].Literal
+	if len(toks) < 4 || toks[1].Kind != token.EQ || toks[2].Kind != token.FUNCTION || toks[3].Kind != token.LPAREN {
+		return sig
+	}
+	var params []string
+	depth := 0
+	expectParam := true
+	for _, tok := range toks[4:] {
+		switch tok.Kind {
+		case token.LPAREN, token.LBRACE, token.LBRACKET:
+			depth += 1
+		case token.RPAREN, token.RBRACE, token.RBRACKET:
+			depth -= 1
+		case token.COMMA:
+			if depth == 0 {
+				expectParam = true
+			}
+		case token.IDENT:
+			if expectParam && depth == 0 {
+				params = append(params, tok.Literal)
+				expectParam = false
+			}
+		}
+		if depth < 0 || tok.Kind == token.EOF {
+			break
+		}
+	}
+	return sig + " = fn(" + strings.Join(params, ", ") + ")"
+}
+
+// writeText writes bindings as plain text, with each doc comment
+// indented under its declaration.
+func writeText(w io.Writer, bindings []binding) {
+	for _, b := range bindings {
+		fmt.Fprintln(w, b.signature)
+		if b.doc != "" {
+			for _, line := range strings.Split(b.doc, "\n") {
+				fmt.Fprintln(w, strings.TrimRight("    "+line, " "))
+			}
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+// writeMarkdown writes bindings as a Markdown section each.
+func writeMarkdown(w io.Writer, bindings []binding) {
+	for _, b := range bindings {
+		fmt.Fprintf(w, "## %s\n\n```\n%s\n```\n\n", b.name, b.signature)
+		if b.doc != "" {
+			fmt.Fprintf(w, "%s\n\n", b.doc)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"github/com/styvane/monkey/lexer"
+	"reflect"
+	"testing"
+)
+
+func TestExportedBindings(t *testing.T) {
+	input := `/// Adds two numbers.
+let add = fn(a, b) { a + b; };
+/// Hidden.
+let _helper = fn(x) { x };
+let typed = fn(x: int, f: fn(int) -> int, ys: [int]) { f(x) };
+let nested = fn() { let inner = 1; inner };
+let five = 5;
+`
+	expected := []binding{
+		{"add", "let add = fn(a, b)", "Adds two numbers."},
+		{"typed", "let typed = fn(x, f, ys)", ""},
+		{"nested", "let nested = fn()", ""},
+		{"five", "let five", ""},
+	}
+
+	got := exportedBindings(lexer.Tokenize(input))
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("exportedBindings wrong. expected=%+v, got=%+v", expected, got)
+	}
+}
+
+func TestWriteDoc(t *testing.T) {
+	bindings := []binding{
+		{"add", "let add = fn(a, b)", "Adds two numbers.\n\nIt is commutative."},
+		{"five", "let five", ""},
+	}
+
+	tests := []struct {
+		write    func(*bytes.Buffer)
+		expected string
+	}{
+		{
+			func(b *bytes.Buffer) { writeText(b, bindings) },
+			"let add = fn(a, b)\n    Adds two numbers.\n\n    It is commutative.\n\nlet five\n\n",
+		},
+		{
+			func(b *bytes.Buffer) { writeMarkdown(b, bindings) },
+			"## add\n\n```\nlet add = fn(a, b)\n```\n\nAdds two numbers.\n\nIt is commutative.\n\n" +
+				"## five\n\n```\nlet five\n```\n\n",
+		},
+	}
+
+	for i, tt := range tests {
+		var b bytes.Buffer
+		tt.write(&b)
+		if b.String() != tt.expected {
+			t.Errorf("tests[%d] - output wrong. expected=%q, got=%q", i, tt.expected, b.String())
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github/com/styvane/monkey/highlight"
+	"io"
+)
+
+func runHighlight(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("highlight", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	asHTML := flags.Bool("html", false, "emit HTML instead of ANSI colors")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: monkey highlight [-html] file.mk (use - for stdin)")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return parseExitCode(err)
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return exitUsage
+	}
+
+	src, err := readSource(flags.Arg(0), stdin)
+	if err != nil {
+		fmt.Fprintf(stderr, "monkey: %v\n", err)
+		return exitError
+	}
+	emit := highlight.ANSI
+	if *asHTML {
+		emit = highlight.HTML
+	}
+	if err := emit(stdout, string(src)); err != nil {
+		fmt.Fprintf(stderr, "monkey: %v\n", err)
+		return exitError
+	}
+	return exitOK
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github/com/styvane/monkey/diagnostics"
+	"github/com/styvane/monkey/lexer"
+	"github/com/styvane/monkey/token"
+	"io"
+	"os"
+)
+
+// jsonToken is the JSON form of a token printed by lex -json.
+type jsonToken struct {
+	Type    string     `json:"type"`
+	Kind    token.Kind `json:"kind"`
+	Literal string     `json:"literal"`
+	Line    int        `json:"line"`
+	Column  int        `json:"column"`
+	Offset  int        `json:"offset"`
+}
+
+func runLex(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("lex", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	strict := flags.Bool("strict", false, "reject identifiers mixing scripts")
+	asJSON := flags.Bool("json", false, "print tokens and diagnostics as newline-delimited JSON")
+	tabWidth := flags.Int("tabwidth", 0, "distance between tab stops in columns (0 counts a tab as one column)")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: monkey lex [-strict] [-json] [-tabwidth=n] file.mk (use - for stdin)")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return parseExitCode(err)
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return exitUsage
+	}
+
+	path := flags.Arg(0)
+	src, err := readSource(path, stdin)
+	if err != nil {
+		fmt.Fprintf(stderr, "monkey: %v\n", err)
+		return exitError
+	}
+
+	var diags []diagnostics.Diagnostic
+	enc := json.NewEncoder(stdout)
+	l := lexer.NewWithOptions(string(src), lexer.Options{Strict: *strict, TabWidth: *tabWidth})
+	for tok := l.NextToken(); tok.Kind != token.EOF; tok = l.NextToken() {
+		if *asJSON {
+			enc.Encode(jsonToken{"token", tok.Kind, tok.Literal, tok.Lineno, tok.LineColumn, tok.Offset})
+		} else {
+			fmt.Fprintf(stdout, "%d:%d\t%s\t%q\n", tok.Lineno, tok.LineColumn, tok.Kind, tok.Literal)
+		}
+		if d, ok := lexer.Diagnose(tok); ok {
+			diags = append(diags, d)
+		}
+	}
+	if len(diags) == 0 {
+		return exitOK
+	}
+	if *asJSON {
+		diagnostics.JSON{Filename: path}.Render(stdout, diags)
+	} else {
+		diagnostics.Terminal{Filename: path, Source: string(src)}.Render(stderr, diags)
+	}
+	return exitError
+}
+
+// readSource reads the source file at path, or stdin when path is "-".
+func readSource(path string, stdin io.Reader) ([]byte, error) {
+	if path == "-" {
+		return io.ReadAll(stdin)
+	}
+	return os.ReadFile(path)
+}
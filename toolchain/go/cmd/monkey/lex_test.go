@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files under testdata")
+
+// TestLexJSON runs lex -json on testdata/lex.mk read from stdin and
+// compares the records with testdata/lex.json. Run go test -update to
+// write it after a deliberate change, and review its diff.
+func TestLexJSON(t *testing.T) {
+	src, err := os.ReadFile(filepath.Join("testdata", "lex.mk"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"lex", "-json", "-"}, bytes.NewReader(src), &stdout, &stderr); code != exitError {
+		t.Fatalf("exit code wrong. expected=%d, got=%d", exitError, code)
+	}
+	if stderr.Len() != 0 {
+		t.Fatalf("unexpected output on stderr: %q", stderr.String())
+	}
+
+	golden := filepath.Join("testdata", "lex.json")
+	if *update {
+		if err := os.WriteFile(golden, stdout.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	expected, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("%v (run go test -update to create it)", err)
+	}
+	if stdout.String() != string(expected) {
+		t.Errorf("records wrong.\nexpected:\n%s\ngot:\n%s", expected, stdout.String())
+	}
+}
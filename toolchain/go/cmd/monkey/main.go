@@ -0,0 +1,105 @@
+// Command monkey is the entry point of the Monkey programming language.
+//
+// Usage:
+//
+//	monkey <command> [arguments]
+//
+// The commands are:
+//
+//	repl        start an interactive session (the default)
+//	lex         print the tokens of a source file
+//	highlight   print a source file with syntax highlighting
+//	doc         print the documentation of a source file
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Exit codes.
+const (
+	exitOK    = 0
+	exitError = 1
+	exitUsage = 2
+)
+
+// A command is a monkey subcommand.
+type command struct {
+	name  string
+	usage string
+	run   func(args []string, stdin io.Reader, stdout, stderr io.Writer) int
+}
+
+var commands []command
+
+func init() {
+	commands = []command{
+		{"repl", "start an interactive session (the default)", runRepl},
+		{"lex", "print the tokens of a source file", runLex},
+		{"highlight", "print a source file with syntax highlighting", runHighlight},
+		{"doc", "print the documentation of a source file", runDoc},
+		{"help", "show this help", runHelp},
+	}
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run dispatches args to the named subcommand and returns the exit code.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) > 0 && isHelpFlag(args[0]) {
+		return runHelp(args[1:], stdin, stdout, stderr)
+	}
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		// monkey -no-color starts the REPL too.
+		return runRepl(args, stdin, stdout, stderr)
+	}
+	for _, cmd := range commands {
+		if cmd.name == args[0] {
+			return cmd.run(args[1:], stdin, stdout, stderr)
+		}
+	}
+	fmt.Fprintf(stderr, "monkey: unknown command %q\n", args[0])
+	usage(stderr)
+	return exitUsage
+}
+
+// isHelpFlag returns true if arg asks for help, as the flag package
+// understands it.
+func isHelpFlag(arg string) bool {
+	switch arg {
+	case "-h", "-help", "--h", "--help":
+		return true
+	default:
+		return false
+	}
+}
+
+// parseExitCode returns the exit code for an error from parsing flags:
+// asking for help with -h is not a usage error.
+func parseExitCode(err error) int {
+	if err == flag.ErrHelp {
+		return exitOK
+	}
+	return exitUsage
+}
+
+// usage writes the list of commands to w.
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: monkey <command> [arguments]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "The commands are:")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-10s %s\n", cmd.name, cmd.usage)
+	}
+}
+
+func runHelp(_ []string, _ io.Reader, stdout, _ io.Writer) int {
+	usage(stdout)
+	return exitOK
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing.mk")
+	tests := []struct {
+		args           []string
+		stdin          string
+		expectedCode   int
+		expectedStdout string // a substring of stdout.
+		expectedStderr string // a substring of stderr.
+	}{
+		{[]string{"help"}, "", exitOK, "The commands are:", ""},
+		{[]string{"-h"}, "", exitOK, "The commands are:", ""},
+		{[]string{"-help"}, "", exitOK, "  lex ", ""},
+		{[]string{"bogus"}, "", exitUsage, "", `unknown command "bogus"`},
+		{nil, "", exitOK, "This is the Monkey programming language!", ""},
+		{[]string{"-no-color"}, "", exitOK, "This is the Monkey programming language!", ""},
+		{[]string{"repl", "-bogus"}, "", exitUsage, "", "-bogus"},
+		{[]string{"lex", "-"}, "let x = 1;", exitOK, "1:1\tLET\t\"let\"", ""},
+		{[]string{"lex", "-"}, "let x = @;", exitError, "1:9\tILLEGAL\t\"@\"", "illegal"},
+		{[]string{"lex", missing}, "", exitError, "", "missing.mk"},
+		{[]string{"lex"}, "", exitUsage, "", "Usage: monkey lex"},
+		{[]string{"lex", "-bogus", "-"}, "", exitUsage, "", "-bogus"},
+		{[]string{"lex", "-h"}, "", exitOK, "", "Usage: monkey lex"},
+		{[]string{"doc", "-help"}, "", exitOK, "", "Usage: monkey doc"},
+		{[]string{"highlight", "-h"}, "", exitOK, "", "Usage: monkey highlight"},
+		{[]string{"repl", "-h"}, "", exitOK, "", "-no-color"},
+		{[]string{"highlight", "-"}, "let x = 1;", exitOK, "let", ""},
+		{[]string{"highlight", "a.mk", "b.mk"}, "", exitUsage, "", "Usage: monkey highlight"},
+		{[]string{"doc", "-"}, "/// One.\nlet one = 1;", exitOK, "let one", ""},
+		{[]string{"doc", "-format=html", "-"}, "", exitUsage, "", "Usage: monkey doc"},
+	}
+
+	for i, tt := range tests {
+		var stdout, stderr bytes.Buffer
+		code := run(tt.args, strings.NewReader(tt.stdin), &stdout, &stderr)
+		if code != tt.expectedCode {
+			t.Errorf("tests[%d] - run(%q) exit code wrong. expected=%d, got=%d (stderr %q)",
+				i, tt.args, tt.expectedCode, code, stderr.String())
+		}
+		if !strings.Contains(stdout.String(), tt.expectedStdout) {
+			t.Errorf("tests[%d] - run(%q) stdout wrong. expected to contain %q, got=%q",
+				i, tt.args, tt.expectedStdout, stdout.String())
+		}
+		if !strings.Contains(stderr.String(), tt.expectedStderr) {
+			t.Errorf("tests[%d] - run(%q) stderr wrong. expected to contain %q, got=%q",
+				i, tt.args, tt.expectedStderr, stderr.String())
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github/com/styvane/monkey/repl"
+	"io"
+	"os"
+	"os/user"
+)
+
+func runRepl(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("repl", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	noColor := flags.Bool("no-color", false, "disable colors (also disabled by setting NO_COLOR)")
+	if err := flags.Parse(args); err != nil {
+		return parseExitCode(err)
+	}
+
+	name := "there"
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+	fmt.Fprintf(stdout, "Hello %s! This is the Monkey programming language!\n", name)
+	fmt.Fprintf(stdout, "Feel free to type in commands\n")
+	color := !*noColor && os.Getenv("NO_COLOR") == "" && isTerminal(stdout)
+	repl.StartWithOptions(stdin, stdout, repl.Options{Color: color})
+	return exitOK
+}
+
+// isTerminal returns true if w is a terminal.
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,3 @@
+let name = "monkey";
+let s = "hello ${name}!";
+let 1x = @;
@@ -0,0 +1,206 @@
+// Package diagnostics implements the errors and warnings reported about
+// Monkey source, and their rendering.
+package diagnostics
+
+import (
+	"encoding/json"
+	"fmt"
+	"github/com/styvane/monkey/token"
+	"io"
+	"strings"
+)
+
+// Severity is the severity of a diagnostic.
+type Severity int
+
+const (
+	Error Severity = iota
+	Warning
+	Note
+)
+
+func (s Severity) String() string {
+	switch s {
+	case Error:
+		return "error"
+	case Warning:
+		return "warning"
+	case Note:
+		return "note"
+	default:
+		return fmt.Sprintf("Severity(%d)", int(s))
+	}
+}
+
+// MarshalText encodes the severity as its name.
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// A Diagnostic is a problem found in the source.
+type Diagnostic struct {
+	Severity Severity
+	Span     token.Span
+	Length   int // number of characters covered by the problem.
+	Message  string
+	Code     string   // stable identifier, e.g. "unterminated-string".
+	Hints    []string // suggestions for fixing the problem.
+}
+
+// A Renderer writes diagnostics.
+type Renderer interface {
+	Render(w io.Writer, diags []Diagnostic) error
+}
+
+// Plain renders diagnostics as one "file:line:col: severity: message"
+// line each, followed by their hints.
+type Plain struct {
+	Filename string
+}
+
+func (p Plain) Render(w io.Writer, diags []Diagnostic) error {
+	var sb strings.Builder
+	for _, d := range diags {
+		fmt.Fprintf(&sb, "%s:%d:%d: %s: %s\n", p.Filename, d.Span.Lineno, d.Span.LineColumn, d.Severity, d.Message)
+		for _, hint := range d.Hints {
+			fmt.Fprintf(&sb, "\thint: %s\n", hint)
+		}
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// Terminal renders diagnostics with an excerpt of the source line and a
+// caret under the problem, optionally in color.
+type Terminal struct {
+	Filename string
+	Source   string
+	Color    bool
+}
+
+// ANSI escape sequences used by Terminal.
+const (
+	bold  = "\x1b[1m"
+	red   = "\x1b[1;31m"
+	amber = "\x1b[1;33m"
+	blue  = "\x1b[1;34m"
+	reset = "\x1b[0m"
+)
+
+func (t Terminal) Render(w io.Writer, diags []Diagnostic) error {
+	src := []rune(t.Source)
+	paint := func(color, s string) string {
+		if !t.Color {
+			return s
+		}
+		return color + s + reset
+	}
+
+	var sb strings.Builder
+	for _, d := range diags {
+		color := red
+		switch d.Severity {
+		case Warning:
+			color = amber
+		case Note:
+			color = blue
+		}
+		header := d.Severity.String()
+		if d.Code != "" {
+			header += "[" + d.Code + "]"
+		}
+		fmt.Fprintf(&sb, "%s%s\n", paint(color, header), paint(bold, ": "+d.Message))
+
+		start, index := lineStart(src, d.Span.Offset)
+		fmt.Fprintf(&sb, "  --> %s:%d:%d\n", t.Filename, d.Span.Lineno, d.Span.LineColumn)
+		end := start
+		for end < len(src) && src[end] != '\n' {
+			end += 1
+		}
+		gutter := fmt.Sprintf("%d", d.Span.Lineno)
+		pad := strings.Repeat(" ", len(gutter))
+		fmt.Fprintf(&sb, "%s %s\n", pad, paint(blue, "|"))
+		fmt.Fprintf(&sb, "%s %s %s\n", paint(blue, gutter), paint(blue, "|"), string(src[start:end]))
+
+		// Tabs are kept in the indentation so the caret lines up.
+		var indent strings.Builder
+		for _, ch := range src[start : start+index-1] {
+			if ch == '\t' {
+				indent.WriteRune('\t')
+			} else {
+				indent.WriteRune(' ')
+			}
+		}
+		length := d.Length
+		if room := end - (start + index - 1); length > room {
+			length = room
+		}
+		if length < 1 {
+			length = 1
+		}
+		fmt.Fprintf(&sb, "%s %s %s%s\n", pad, paint(blue, "|"), indent.String(), paint(color, strings.Repeat("^", length)))
+		for _, hint := range d.Hints {
+			fmt.Fprintf(&sb, "%s %s hint: %s\n", pad, paint(blue, "="), hint)
+		}
+		sb.WriteString("\n")
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// lineStart returns the offset of the start of the line containing
+// offset and the 1-based index of offset on that line. Unlike a span
+// column, the index counts a tab as one character.
+func lineStart(src []rune, offset int) (int, int) {
+	if offset > len(src) {
+		offset = len(src)
+	}
+	start := offset
+	for start > 0 && src[start-1] != '\n' {
+		start -= 1
+	}
+	return start, offset - start + 1
+}
+
+// JSON renders diagnostics as newline-delimited JSON objects. Each one
+// has a "type" of "diagnostic" so that it can be mixed with other
+// records in a stream.
+type JSON struct {
+	Filename string
+}
+
+// jsonDiagnostic is the JSON form of a diagnostic.
+type jsonDiagnostic struct {
+	Type     string   `json:"type"`
+	File     string   `json:"file"`
+	Severity Severity `json:"severity"`
+	Line     int      `json:"line"`
+	Column   int      `json:"column"`
+	Offset   int      `json:"offset"`
+	Length   int      `json:"length"`
+	Message  string   `json:"message"`
+	Code     string   `json:"code,omitempty"`
+	Hints    []string `json:"hints,omitempty"`
+}
+
+func (j JSON) Render(w io.Writer, diags []Diagnostic) error {
+	enc := json.NewEncoder(w)
+	for _, d := range diags {
+		err := enc.Encode(jsonDiagnostic{
+			Type:     "diagnostic",
+			File:     j.Filename,
+			Severity: d.Severity,
+			Line:     d.Span.Lineno,
+			Column:   d.Span.LineColumn,
+			Offset:   d.Span.Offset,
+			Length:   d.Length,
+			Message:  d.Message,
+			Code:     d.Code,
+			Hints:    d.Hints,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package diagnostics
+
+import (
+	"strings"
+	"testing"
+
+	"github/com/styvane/monkey/token"
+)
+
+var diags = []Diagnostic{
+	{
+		Severity: Error,
+		Span:     token.NewSpan(2, 10, 20),
+		Length:   2,
+		Message:  "illegal identifier \"1x\"",
+		Code:     "illegal-identifier",
+		Hints:    []string{"identifiers cannot start with a digit"},
+	},
+	{Severity: Warning, Span: token.NewSpan(1, 5, 4), Length: 1, Message: "unused"},
+}
+
+const source = "let a = 1;\n\tlet b = 1x;\n"
+
+func TestTerminal(t *testing.T) {
+	var sb strings.Builder
+	if err := (Terminal{Filename: "a.mk", Source: source}).Render(&sb, diags); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `error[illegal-identifier]: illegal identifier "1x"
+  --> a.mk:2:10
+  |
+2 | 	let b = 1x;
+  | 	        ^^
+  = hint: identifiers cannot start with a digit
+
+warning: unused
+  --> a.mk:1:5
+  |
+1 | let a = 1;
+  |     ^
+
+`
+	if sb.String() != expected {
+		t.Errorf("Terminal wrong.\nexpected=%q\ngot=%q", expected, sb.String())
+	}
+}
+
+func TestPlain(t *testing.T) {
+	var sb strings.Builder
+	if err := (Plain{Filename: "a.mk"}).Render(&sb, diags[:1]); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "a.mk:2:10: error: illegal identifier \"1x\"\n\thint: identifiers cannot start with a digit\n"
+	if sb.String() != expected {
+		t.Errorf("Plain wrong.\nexpected=%q\ngot=%q", expected, sb.String())
+	}
+}
+
+func TestJSON(t *testing.T) {
+	var sb strings.Builder
+	if err := (JSON{Filename: "a.mk"}).Render(&sb, diags); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `{"type":"diagnostic","file":"a.mk","severity":"error","line":2,"column":10,"offset":20,"length":2,"message":"illegal identifier \"1x\"","code":"illegal-identifier","hints":["identifiers cannot start with a digit"]}
+{"type":"diagnostic","file":"a.mk","severity":"warning","line":1,"column":5,"offset":4,"length":1,"message":"unused"}
+`
+	if sb.String() != expected {
+		t.Errorf("JSON wrong.\nexpected=%s\ngot=%s", expected, sb.String())
+	}
+}
@@ -0,0 +1,175 @@
+// Package highlight implements syntax highlighting of Monkey source.
+package highlight
+
+import (
+	"fmt"
+	"github/com/styvane/monkey/lexer"
+	"github/com/styvane/monkey/token"
+	"html"
+	"io"
+	"strings"
+)
+
+// Class is the semantic class of a piece of source text.
+type Class int
+
+const (
+	Plain Class = iota // whitespace and text between tokens.
+	Keyword
+	Number
+	String
+	Operator
+	Delimiter
+	Identifier
+	Comment
+	Error // illegal characters and unterminated strings.
+)
+
+var classNames = [...]string{
+	Plain:      "plain",
+	Keyword:    "keyword",
+	Number:     "number",
+	String:     "string",
+	Operator:   "operator",
+	Delimiter:  "delimiter",
+	Identifier: "identifier",
+	Comment:    "comment",
+	Error:      "error",
+}
+
+func (c Class) String() string {
+	if c < 0 || int(c) >= len(classNames) {
+		return fmt.Sprintf("Class(%d)", int(c))
+	}
+	return classNames[c]
+}
+
+// Classify returns the class of tokens of the given kind.
+func Classify(kind token.Kind) Class {
+	if token.IsKeyword(kind) {
+		return Keyword
+	}
+	switch kind {
+	case token.IDENT:
+		return Identifier
+	case token.NUMBER:
+		return Number
+	case token.STRING, token.INTERP_START, token.INTERP_END:
+		return String
+	case token.LPAREN, token.RPAREN, token.LBRACE, token.RBRACE,
+		token.LBRACKET, token.RBRACKET, token.COMMA, token.SEMI, token.COLON:
+		return Delimiter
+	case token.ILLEGAL, token.UNTERMINATED:
+		return Error
+	case token.EOF:
+		return Plain
+	default:
+		return Operator
+	}
+}
+
+// A Segment is a run of source text of a single class.
+type Segment struct {
+	Text  string
+	Class Class
+}
+
+// Segments splits src into classified segments. Concatenating their
+// text gives back src.
+func Segments(src string) []Segment {
+	runes := []rune(src)
+	var segs []Segment
+	l := lexer.New(src)
+	end := 0
+	for {
+		tok := l.NextToken()
+		if tok.Offset < end {
+			// A string left open in an interpolation is reported
+			// again from its quote; its text is already segmented.
+			continue
+		}
+		segs = appendGap(segs, runes[end:tok.Offset])
+		if tok.Kind == token.EOF {
+			return segs
+		}
+		end = l.Offset()
+		segs = append(segs, Segment{string(runes[tok.Offset:end]), Classify(tok.Kind)})
+	}
+}
+
+// appendGap appends the segments of the whitespace and comments the
+// lexer skipped between two tokens, or before the first one.
+func appendGap(segs []Segment, gap []rune) []Segment {
+	for len(gap) > 0 {
+		n := 0
+		class := Plain
+		if startsComment(gap) {
+			class = Comment
+			for n < len(gap) && gap[n] != '\n' {
+				n += 1
+			}
+		} else {
+			for n < len(gap) && !startsComment(gap[n:]) {
+				n += 1
+			}
+		}
+		segs = append(segs, Segment{string(gap[:n]), class})
+		gap = gap[n:]
+	}
+	return segs
+}
+
+// startsComment returns true if gap starts with a // comment or a #!
+// line, the only other text the lexer skips.
+func startsComment(gap []rune) bool {
+	return len(gap) > 1 && (gap[0] == '/' && gap[1] == '/' || gap[0] == '#' && gap[1] == '!')
+}
+
+// ANSI escape sequences for each class.
+var ansiColors = map[Class]string{
+	Keyword:  "\x1b[1;35m",
+	Number:   "\x1b[36m",
+	String:   "\x1b[32m",
+	Operator: "\x1b[33m",
+	Comment:  "\x1b[90m",
+	Error:    "\x1b[4;31m",
+}
+
+const ansiReset = "\x1b[0m"
+
+// ANSI writes src to w colored with ANSI terminal escape sequences.
+func ANSI(w io.Writer, src string) error {
+	var sb strings.Builder
+	for _, seg := range Segments(src) {
+		sb.WriteString(Paint(seg.Class, seg.Text))
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// Paint returns text colored like the segments of class c in ANSI
+// output.
+func Paint(c Class, text string) string {
+	if color, ok := ansiColors[c]; ok {
+		return color + text + ansiReset
+	}
+	return text
+}
+
+// HTML writes src to w as a <pre> element in which each segment that is
+// not plain text is a <span> whose CSS class is the segment class name.
+func HTML(w io.Writer, src string) error {
+	var sb strings.Builder
+	sb.WriteString(`<pre class="monkey">`)
+	for _, seg := range Segments(src) {
+		text := html.EscapeString(seg.Text)
+		if seg.Class == Plain {
+			sb.WriteString(text)
+		} else {
+			fmt.Fprintf(&sb, `<span class="%s">%s</span>`, seg.Class, text)
+		}
+	}
+	sb.WriteString("</pre>\n")
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
@@ -0,0 +1,67 @@
+package highlight
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSegments(t *testing.T) {
+	input := "let s = \"a ${x + 1} b\";\n  fn(y) { y == @ } // done\n"
+	expected := []Segment{
+		{"let", Keyword}, {" ", Plain}, {"s", Identifier}, {" ", Plain},
+		{"=", Operator}, {" ", Plain}, {`"a `, String}, {"${", String},
+		{"x", Identifier}, {" ", Plain}, {"+", Operator}, {" ", Plain},
+		{"1", Number}, {"}", String}, {` b"`, String}, {";", Delimiter},
+		{"\n  ", Plain}, {"fn", Keyword}, {"(", Delimiter}, {"y", Identifier},
+		{")", Delimiter}, {" ", Plain}, {"{", Delimiter}, {" ", Plain},
+		{"y", Identifier}, {" ", Plain}, {"==", Operator}, {" ", Plain},
+		{"@", Error}, {" ", Plain}, {"}", Delimiter}, {" ", Plain},
+		{"// done", Comment}, {"\n", Plain},
+	}
+
+	segs := Segments(input)
+	if len(segs) != len(expected) {
+		t.Fatalf("segments wrong. expected=%q, got=%q", expected, segs)
+	}
+	for i, seg := range segs {
+		if seg != expected[i] {
+			t.Errorf("segments[%d] wrong. expected=%q, got=%q", i, expected[i], seg)
+		}
+	}
+}
+
+func TestSegmentsCoverSource(t *testing.T) {
+	inputs := []string{
+		"",
+		"   ",
+		"\"unterminated ${ x",
+		"let café = \"${\"${1}\"}\"  ;",
+		"\tmatch x { 1 => a ?? b, _ => 1..10 }\n\n",
+		"/// doc\n// plain\nlet x = 1; //",
+		"\uFEFF#!/usr/bin/env monkey\nlet x = 1;",
+	}
+
+	for _, input := range inputs {
+		var sb strings.Builder
+		for _, seg := range Segments(input) {
+			sb.WriteString(seg.Text)
+		}
+		if sb.String() != input {
+			t.Errorf("segments of %q rebuild %q", input, sb.String())
+		}
+	}
+}
+
+func TestHTML(t *testing.T) {
+	var sb strings.Builder
+	if err := HTML(&sb, `let x = "<b>";`); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `<pre class="monkey"><span class="keyword">let</span> <span class="identifier">x</span> ` +
+		`<span class="operator">=</span> <span class="string">&#34;&lt;b&gt;&#34;</span>` +
+		`<span class="delimiter">;</span></pre>` + "\n"
+	if sb.String() != expected {
+		t.Errorf("HTML wrong.\nexpected=%s\ngot=%s", expected, sb.String())
+	}
+}
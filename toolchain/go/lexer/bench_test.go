@@ -0,0 +1,85 @@
+package lexer
+
+import (
+	"fmt"
+	"github/com/styvane/monkey/token"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// generateProgram returns a program of n statements mixing the
+// constructs of the language, the same for a given n.
+func generateProgram(n int) string {
+	var sb strings.Builder
+	for i := 0; i < n; i++ {
+		switch i % 5 {
+		case 0:
+			fmt.Fprintf(&sb, "let x%d = %d * (y + 2) - z / 4;\n", i, i)
+		case 1:
+			fmt.Fprintf(&sb, "let f%d = fn(a, b) { if (a < b) { return a; } else { b } };\n", i)
+		case 2:
+			fmt.Fprintf(&sb, "let s%d = \"item ${x%d + 1} of ${len(xs)}\";\n", i, i-2)
+		case 3:
+			fmt.Fprintf(&sb, "/// Doc for h%d.\nlet h%d = {\"key\": [1, 2, 3], \"other\": true}; // comment\n", i, i)
+		case 4:
+			fmt.Fprintf(&sb, "match x%d { 1 => \"one\", _ => a ?? b } |> f%d(2 ** 3);\n", i-4, i-3)
+		}
+	}
+	return sb.String()
+}
+
+// BenchmarkNextToken lexes generated programs without keeping the
+// tokens, which would not fit in memory for the largest ones.
+func BenchmarkNextToken(b *testing.B) {
+	for _, n := range []int{10_000, 100_000, 1_000_000} {
+		b.Run(fmt.Sprintf("statements=%d", n), func(b *testing.B) {
+			src := generateProgram(n)
+			b.SetBytes(int64(len(src)))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				l := New(src)
+				for tok := l.NextToken(); tok.Kind != token.EOF; tok = l.NextToken() {
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkTokenizeCorpus(b *testing.B) {
+	paths, err := filepath.Glob(filepath.Join("testdata", "corpus", "*.mk"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	for _, path := range paths {
+		src, err := os.ReadFile(path)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Run(filepath.Base(path), func(b *testing.B) {
+			b.SetBytes(int64(len(src)))
+			for i := 0; i < b.N; i++ {
+				Tokenize(string(src))
+			}
+		})
+	}
+}
+
+func TestCorpus(t *testing.T) {
+	paths, err := filepath.Glob(filepath.Join("testdata", "corpus", "*.mk"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range paths {
+		src, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, tok := range Tokenize(string(src)) {
+			if d, ok := Diagnose(tok); ok {
+				t.Errorf("%s:%d:%d: %s", path, tok.Lineno, tok.LineColumn, d.Message)
+			}
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package lexer
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files under testdata/golden")
+
+// TestGolden lexes each testdata/golden/*.mk file and compares its tokens
+// with the .tokens file next to it. Run go test -update to write the
+// .tokens files after a deliberate change, and review their diff.
+func TestGolden(t *testing.T) {
+	paths, err := filepath.Glob(filepath.Join("testdata", "golden", "*.mk"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range paths {
+		src, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := dumpTokens(string(src))
+		golden := strings.TrimSuffix(path, ".mk") + ".tokens"
+		if *update {
+			if err := os.WriteFile(golden, []byte(got), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		expected, err := os.ReadFile(golden)
+		if err != nil {
+			t.Fatalf("%v (run go test -update to create it)", err)
+		}
+		if got != string(expected) {
+			t.Errorf("tokens of %s wrong.\nexpected:\n%s\ngot:\n%s", path, expected, got)
+		}
+	}
+}
+
+// dumpTokens returns the tokens of src one per line, like monkey lex,
+// with the diagnostics of error tokens and the doc comments.
+func dumpTokens(src string) string {
+	var sb strings.Builder
+	for _, tok := range Tokenize(src) {
+		fmt.Fprintf(&sb, "%d:%d\t%s\t%q", tok.Lineno, tok.LineColumn, tok.Kind, tok.Literal)
+		if tok.Doc != "" {
+			fmt.Fprintf(&sb, "\tdoc=%q", tok.Doc)
+		}
+		if d, ok := Diagnose(tok); ok {
+			fmt.Fprintf(&sb, "\t%s: %s", d.Code, d.Message)
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
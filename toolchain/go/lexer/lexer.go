@@ -2,40 +2,132 @@
 package lexer
 
 import (
+	"fmt"
+	"github/com/styvane/monkey/diagnostics"
 	"github/com/styvane/monkey/token"
+	"strings"
 	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
 )
 
+// Options configures a Lexer.
+type Options struct {
+	// Strict rejects identifiers mixing letters from several scripts,
+	// such as "pаypal" spelled with a Cyrillic "а", by lexing them as
+	// ILLEGAL tokens.
+	Strict bool
+
+	// Keywords maps additional keywords to their kind, for this lexer
+	// only. They take precedence over the language keywords. Use
+	// token.RegisterKeyword to add keywords to every lexer.
+	Keywords map[string]token.Kind
+
+	// InsertSemis ends a statement at a newline, as Go does. A SEMI token
+	// with the literal "\n" is inserted when the last token on the line
+	// can end an expression: an identifier, a literal, return or a closing
+	// delimiter. A line that ends with an operator or a comma continues on
+	// the next one.
+	InsertSemis bool
+
+	// TabWidth is the distance between tab stops used to compute
+	// columns. When it is 0, a tab is one column like any other
+	// character.
+	TabWidth int
+}
+
 // Lexer represents the lexer type or tokenizer.
 type Lexer struct {
+	opts         Options
 	input        []rune
 	lineNumber   int  // current line number in input.
+	column       int  // current column in the line, from 1.
 	position     int  // current position in input (points to current char)
 	readPosition int  // next character position in input (after current char)
 	ch           rune // current char under examination
+
+	doc         []string   // doc comment lines read since the last token.
+	docLine     bool       // the current line is a doc comment line.
+	quote       token.Span // the opening quote of the string being read.
+	interps     []interp   // the open string interpolations, innermost last.
+	inString    bool       // the next token continues a string literal.
+	startInterp bool       // the next token is an interpolation start.
+	last        token.Kind // the kind of the last token read.
+}
+
+// interp is an open string interpolation.
+type interp struct {
+	depth int        // brace depth inside the interpolation.
+	quote token.Span // the opening quote of the enclosing string.
 }
 
 // New returns an initialized Lexer instance.
 func New(input string) *Lexer {
-	l := &Lexer{input: []rune(input)}
+	return NewWithOptions(input, Options{})
+}
+
+// NewWithOptions returns an initialized Lexer instance using opts.
+func NewWithOptions(input string, opts Options) *Lexer {
+	l := &Lexer{input: []rune(input), opts: opts, lineNumber: 1, column: 1}
 	l.readChar()
-	l.lineNumber += 1
+	l.skipPreamble()
 	return l
 }
 
+// skipPreamble skips a byte order mark and a #! line at the start of the
+// input, so that scripts can be made executable on Unix systems. Offsets
+// still count them.
+func (l *Lexer) skipPreamble() {
+	if l.ch == '\uFEFF' {
+		l.readChar()
+		l.column = 1 // the mark is not displayed.
+	}
+	if l.ch == '#' && l.peekChar() == '!' {
+		for !l.atEOF() && l.ch != '\n' {
+			l.readChar()
+		}
+	}
+}
+
 // ReadChar reads the next character in the input.
 func (l *Lexer) readChar() {
+	if l.readPosition > 0 && !l.atEOF() {
+		l.advance()
+	}
 	if l.readPosition >= len(l.input) {
+		// Stay at the end of input.
 		l.ch = 0
-	} else {
-		l.ch = l.input[l.readPosition]
-	}
-	if l.ch == '\n' {
-		l.lineNumber += 1
+		l.position = len(l.input)
+		return
 	}
+	l.ch = l.input[l.readPosition]
 	l.position = l.readPosition
 	l.readPosition += 1
+}
 
+// advance moves the line and column past the current character.
+func (l *Lexer) advance() {
+	switch {
+	case l.ch == '\n':
+		l.lineNumber += 1
+		l.column = 1
+	case l.ch == '\t' && l.opts.TabWidth > 0:
+		l.column += l.opts.TabWidth - (l.column-1)%l.opts.TabWidth
+	default:
+		l.column += 1
+	}
+}
+
+// span returns the span of the current character.
+func (l *Lexer) span() token.Span {
+	return token.NewSpan(l.lineNumber, l.column, l.position)
+}
+
+// atEOF returns true if the whole input has been read. The current
+// character is also 0 then, but so is a NUL in the input.
+func (l *Lexer) atEOF() bool {
+	return l.position >= len(l.input)
 }
 
 // isDelimiter returns true if the character is a delimiter.
@@ -51,7 +143,7 @@ func isDelimiter(ch rune) bool {
 // isOp returns true if the character is an operator.
 func isOp(ch rune) bool {
 	switch ch {
-	case '+', '-', '*', '/', '!', '=', '<', '>':
+	case '+', '-', '*', '/', '!', '=', '<', '>', '?', '&', '|', '^', '~':
 		return true
 	default:
 		return false
@@ -59,74 +151,202 @@ func isOp(ch rune) bool {
 }
 
 // NextToken returns the token corresponding to the current input character.
+// Whitespace and comments before it are skipped; the doc comments among
+// them are attached to the token.
+//
+// Tokens come in input order, with one exception: the UNTERMINATED token
+// of a string left open after an interpolation starts at the string's
+// quote, before its segments and interpolations read so far.
 func (l *Lexer) NextToken() token.Token {
+	tok := l.nextToken()
+	l.last = tok.Kind
+	if len(l.doc) > 0 {
+		// Blank lines around the text are not part of it.
+		tok.Doc = strings.Trim(strings.Join(l.doc, "\n"), "\n")
+		l.doc = nil
+	}
+	return tok
+}
+
+// Offset returns the position in input just past the last token read.
+func (l *Lexer) Offset() int {
+	return l.position
+}
+
+func (l *Lexer) nextToken() token.Token {
 	var tok token.Token
 	var tokKind token.Kind
 	var literal string
-	l.eatWhitespace()
-	position := l.position
-	lineno := l.lineNumber
+	if l.inString {
+		l.inString = false
+		return l.readString(l.span())
+	}
+	if l.startInterp {
+		l.startInterp = false
+		l.interps = append(l.interps, interp{quote: l.quote})
+		tok = token.Token{Kind: token.INTERP_START, Literal: "${", Span: l.span()}
+		l.readChar()
+		l.readChar()
+		return tok
+	}
+	insertSemi := l.opts.InsertSemis && len(l.interps) == 0 && endsStatement(l.last)
+	l.eatWhitespace(insertSemi)
+	start := l.span()
 
 	switch {
+	case insertSemi && l.ch == '\n':
+		literal = "\n"
+		tokKind = token.SEMI
+	case l.ch == '"':
+		l.quote = start
+		l.readChar()
+		return l.readString(start)
+	case len(l.interps) > 0 && (l.ch == '{' || l.ch == '}'):
+		top := len(l.interps) - 1
+		tokKind = token.LookupDelimiter(l.ch)
+		if l.ch == '{' {
+			l.interps[top].depth += 1
+		} else if l.interps[top].depth > 0 {
+			l.interps[top].depth -= 1
+		} else {
+			l.quote = l.interps[top].quote
+			l.interps = l.interps[:top]
+			l.inString = true
+			tokKind = token.INTERP_END
+		}
 	case l.ch == ';':
 		tokKind = token.SEMI
 	case isDelimiter(l.ch):
 		tokKind = token.LookupDelimiter(l.ch)
 	case l.ch == ',':
 		tokKind = token.COMMA
+	case l.ch == ':':
+		tokKind = token.COLON
+	case l.ch == '.' && l.peekChar() == '.':
+		l.readChar()
+		literal = ".."
+		tokKind = token.RANGE
+	case l.ch == '.':
+		tokKind = token.DOT
 	case isOp(l.ch):
-		if l.ch == '!' && l.peekChar() == '=' {
-			ch := l.ch
-			l.readChar()
-			literal = string(ch) + string(l.ch)
-			tokKind = token.NE
-		} else if l.ch == '=' && l.peekChar() == '=' {
+		if kind, ok := token.LookupDoubleOp(string(l.ch) + string(l.peekChar())); ok {
 			ch := l.ch
 			l.readChar()
 			literal = string(ch) + string(l.ch)
-			tokKind = token.EQEQ
-
+			tokKind = kind
 		} else {
 			tokKind = token.LookupOp(l.ch)
 		}
 
-	case l.ch == 0:
+	case l.atEOF() && len(l.interps) > 0:
+		// The input ends inside an interpolation, so the outermost
+		// string is unterminated too. The token starts at its opening
+		// quote, like that of any unterminated string; the EOF token
+		// follows.
+		quote := l.interps[0].quote
+		l.interps = nil
+		literal := string(l.input[quote.Offset:l.position])
+		return token.Token{Kind: token.UNTERMINATED, Literal: literal, Span: quote}
+	case l.atEOF():
 		tok.Literal = ""
 		tok.Kind = token.EOF
+		tok.Span = start
 	default:
-		if isLetter(l.ch) {
+		if isIdentStart(l.ch) {
 			tok.Literal = l.readIdentifier()
 			tok.Kind = token.LookupIdent(tok.Literal)
-			tok.Span = token.NewSpan(lineno, position)
+			if kind, ok := l.opts.Keywords[tok.Literal]; ok {
+				tok.Kind = kind
+			}
+			if l.opts.Strict && mixesScripts(tok.Literal) {
+				tok.Kind = token.ILLEGAL
+			}
+			tok.Span = start
 			return tok
 		} else if isDigit(l.ch) {
-			position = l.position
-			lineno = l.lineNumber
 			tok.Kind = token.NUMBER
 			tok.Literal = l.readNumber()
-			tok.Span = token.NewSpan(lineno, position)
+			if isIdentContinue(l.ch) {
+				// Identifiers cannot start with a digit: 1x is a single
+				// bad token rather than 1 followed by x.
+				for isIdentContinue(l.ch) {
+					l.readChar()
+				}
+				tok.Kind = token.ILLEGAL
+				tok.Literal = string(l.input[start.Offset:l.position])
+			}
+			tok.Span = start
 			return tok
 		} else {
-			tokKind = token.UNKOWN
+			tokKind = token.ILLEGAL
 		}
 	}
 
 	if literal != "" {
-		tok = token.Token{Kind: tokKind, Literal: literal, Span: token.NewSpan(lineno, position)}
+		tok = token.Token{Kind: tokKind, Literal: literal, Span: start}
 	} else if tok.Kind == "" {
-		tok = token.NewToken(tokKind, l.ch, token.NewSpan(l.lineNumber, position))
+		tok = token.NewToken(tokKind, l.ch, start)
 	}
 	l.readChar()
 	return tok
 }
 
-// readIdentifier reads the next identifier in input.
+// readIdentifier reads the next identifier in input. The identifier is
+// returned in NFC form so that visually identical spellings compare
+// equal; its span still refers to the original characters.
 func (l *Lexer) readIdentifier() string {
 	position := l.position
-	for isLetter(l.ch) {
+	for isIdentContinue(l.ch) {
+		l.readChar()
+	}
+	return norm.NFC.String(string(l.input[position:l.position]))
+}
+
+// readString reads a string literal, or the segment of one that ends at
+// an interpolation, starting after the opening quote or the end of the
+// previous interpolation. Escape sequences are decoded in the literal.
+func (l *Lexer) readString(start token.Span) token.Token {
+	var sb strings.Builder
+	for {
+		switch {
+		case l.ch == '"':
+			l.readChar()
+			return token.Token{Kind: token.STRING, Literal: sb.String(), Span: start}
+		case l.ch == '$' && l.peekChar() == '{':
+			l.startInterp = true
+			return token.Token{Kind: token.STRING, Literal: sb.String(), Span: start}
+		case l.atEOF():
+			// The token covers the whole string, from its quote. A
+			// string inside an interpolation leaves the enclosing ones
+			// open too, so a single token covers the outermost.
+			quote := l.quote
+			if len(l.interps) > 0 {
+				quote = l.interps[0].quote
+				l.interps = nil
+			}
+			literal := string(l.input[quote.Offset:l.position])
+			return token.Token{Kind: token.UNTERMINATED, Literal: literal, Span: quote}
+		case l.ch == '\\':
+			l.readChar()
+			if l.atEOF() {
+				continue
+			}
+			switch l.ch {
+			case 'n':
+				sb.WriteRune('\n')
+			case 't':
+				sb.WriteRune('\t')
+			case '"', '\\', '$':
+				sb.WriteRune(l.ch)
+			default:
+				sb.WriteRune('\\')
+				sb.WriteRune(l.ch)
+			}
+		default:
+			sb.WriteRune(l.ch)
+		}
 		l.readChar()
 	}
-	return string(l.input[position:l.position])
 }
 
 // readNumber reads the next character as number.
@@ -138,16 +358,137 @@ func (l *Lexer) readNumber() string {
 	return string(l.input[position:l.position])
 }
 
-// isLetter returns true if the byte corresponds to a letter.
-func isLetter(ch rune) bool {
-	return unicode.IsLetter(ch) || unicode.IsSymbol(ch) || ch == '_'
+// isIdentStart returns true if the character can start an identifier:
+// an underscore or a character with the Unicode ID_Start property.
+// This matches XID_Start except for a few characters that are not
+// stable under NFKC normalization. ASCII is checked without the tables,
+// as most identifiers are written in it.
+func isIdentStart(ch rune) bool {
+	if ch < utf8.RuneSelf {
+		return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_'
+	}
+	return unicode.In(ch, unicode.L, unicode.Nl, unicode.Other_ID_Start) &&
+		!unicode.In(ch, unicode.Pattern_Syntax, unicode.Pattern_White_Space)
+}
+
+// isIdentContinue returns true if the character can appear after the
+// first character of an identifier (Unicode ID_Continue).
+func isIdentContinue(ch rune) bool {
+	if ch < utf8.RuneSelf {
+		return isIdentStart(ch) || isDigit(ch)
+	}
+	if isIdentStart(ch) {
+		return true
+	}
+	return unicode.In(ch, unicode.Mn, unicode.Mc, unicode.Nd, unicode.Pc, unicode.Other_ID_Continue) &&
+		!unicode.In(ch, unicode.Pattern_Syntax, unicode.Pattern_White_Space)
+}
+
+// mixesScripts returns true if ident has letters from more than one
+// script. Characters common to all scripts, like digits and '_', are
+// ignored.
+func mixesScripts(ident string) bool {
+	var first *unicode.RangeTable
+	for _, ch := range ident {
+		if !unicode.IsLetter(ch) {
+			continue
+		}
+		script := scriptOf(ch)
+		if script == nil {
+			continue
+		}
+		if first == nil {
+			first = script
+		} else if script != first {
+			return true
+		}
+	}
+	return false
+}
+
+// scriptOf returns the script table of a character, or nil if it belongs
+// to the Common or Inherited scripts.
+func scriptOf(ch rune) *unicode.RangeTable {
+	if unicode.In(ch, unicode.Common, unicode.Inherited) {
+		return nil
+	}
+	for _, table := range unicode.Scripts {
+		if unicode.Is(table, ch) {
+			return table
+		}
+	}
+	return nil
 }
 
-// eatWhitespace skips white spaces
-func (l *Lexer) eatWhitespace() {
-	for l.ch == ' ' || l.ch == '\t' || l.ch == '\n' || l.ch == '\r' {
+// eatWhitespace skips white spaces and comments, stopping at a newline
+// if stopAtNewline is true.
+func (l *Lexer) eatWhitespace(stopAtNewline bool) {
+	for {
+		switch {
+		case stopAtNewline && l.ch == '\n':
+			return
+		case l.ch == '\n':
+			// A line that is not a doc comment ends the run of doc
+			// comments before it.
+			if !l.docLine {
+				l.doc = nil
+			}
+			l.docLine = false
+			l.readChar()
+		case l.ch == ' ' || l.ch == '\t' || l.ch == '\r':
+			l.readChar()
+		case l.ch == '/' && l.peekChar() == '/':
+			l.readComment()
+		default:
+			return
+		}
+	}
+}
+
+// endsStatement returns true if a token of kind can be the last of a
+// statement, so that a newline after it inserts a semicolon.
+func endsStatement(kind token.Kind) bool {
+	switch kind {
+	case token.IDENT, token.NUMBER, token.STRING, token.TRUE, token.FALSE, token.NULL,
+		token.RETURN, token.RPAREN, token.RBRACKET, token.RBRACE:
+		return true
+	default:
+		return false
+	}
+}
+
+// readComment skips a comment up to the end of the line. Doc comments,
+// lines starting with ///, are kept for the next token; any other
+// comment, including a /// after code, discards those read so far.
+func (l *Lexer) readComment() {
+	position := l.position
+	for !l.atEOF() && l.ch != '\n' {
 		l.readChar()
 	}
+	text := strings.TrimSuffix(string(l.input[position:l.position]), "\r")
+	if rest := strings.TrimPrefix(text, "///"); rest != text && l.startsLine(position) {
+		l.doc = append(l.doc, strings.TrimPrefix(rest, " "))
+		l.docLine = true
+	} else {
+		l.doc = nil
+	}
+}
+
+// startsLine returns true if only blanks come before position on its
+// line.
+func (l *Lexer) startsLine(position int) bool {
+	for i := position - 1; i >= 0; i-- {
+		switch l.input[i] {
+		case ' ', '\t', '\r':
+		case '\n':
+			return true
+		case '\uFEFF':
+			return i == 0
+		default:
+			return false
+		}
+	}
+	return true
 }
 
 // isDigit returns true if the byte corresponds to a digit.
@@ -163,3 +504,37 @@ func (l *Lexer) peekChar() rune {
 		return l.input[l.readPosition]
 	}
 }
+
+// Diagnose returns the diagnostic for the lexical error carried by tok.
+// It returns false if tok is not an error token.
+func Diagnose(tok token.Token) (diagnostics.Diagnostic, bool) {
+	d := diagnostics.Diagnostic{
+		Severity: diagnostics.Error,
+		Span:     tok.Span,
+		Length:   utf8.RuneCountInString(tok.Literal),
+	}
+	switch {
+	case tok.Kind == token.UNTERMINATED:
+		d.Code = "unterminated-string"
+		d.Message = "unterminated string"
+		d.Hints = []string{`add a closing "`}
+	case tok.Kind != token.ILLEGAL:
+		return d, false
+	case tok.Literal == "&&" || tok.Literal == "||":
+		d.Code = "reserved-operator"
+		d.Message = fmt.Sprintf("%s is not an operator", tok.Literal)
+		d.Hints = []string{fmt.Sprintf("use %s for the bitwise operator", tok.Literal[:1])}
+	case d.Length == 1:
+		d.Code = "illegal-character"
+		d.Message = fmt.Sprintf("illegal character %q", tok.Literal)
+	case isDigit([]rune(tok.Literal)[0]):
+		d.Code = "illegal-identifier"
+		d.Message = fmt.Sprintf("illegal identifier %q", tok.Literal)
+		d.Hints = []string{"identifiers cannot start with a digit"}
+	default:
+		d.Code = "illegal-identifier"
+		d.Message = fmt.Sprintf("illegal identifier %q", tok.Literal)
+		d.Hints = []string{"identifiers cannot mix letters from several scripts"}
+	}
+	return d, true
+}
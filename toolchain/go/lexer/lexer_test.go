@@ -2,7 +2,13 @@ package lexer
 
 import (
 	"github/com/styvane/monkey/token"
+	"reflect"
+	"strings"
 	"testing"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
 )
 
 func TestNextToken(t *testing.T) {
@@ -25,6 +31,24 @@ return false;
 10 != 9;
 let ∆ = 9;
 let śńięg = 9;
+let x1 = y2;
+a ?? null;
+h?[0];
+"foobar"
+"foo bar"
+"say \"hi\"\n"
+"sum is ${a + b}!"
+"${f({})}"
+"${"in" + "${x}"}"
+match x { 1 => "one", _ => "other" }
+1..10
+2 ** 3 ** 2 * 4
+a & b | c ^ ~d << 1 >> 2 < 3 > 4
+a && b || c
+let f: fn = fn(x: int) -> int { x - -1 };
+for (x in xs) { inner }
+xs |> map(double) | y
+let p = {x: 1}; p.x
 
 `
 	tests := []struct {
@@ -105,7 +129,7 @@ let śńięg = 9;
 		{token.NUMBER, "9"},
 		{token.SEMI, ";"},
 		{token.LET, "let"},
-		{token.IDENT, "∆"},
+		{token.ILLEGAL, "∆"},
 		{token.EQ, "="},
 		{token.NUMBER, "9"},
 		{token.SEMI, ";"},
@@ -114,6 +138,142 @@ let śńięg = 9;
 		{token.EQ, "="},
 		{token.NUMBER, "9"},
 		{token.SEMI, ";"},
+		{token.LET, "let"},
+		{token.IDENT, "x1"},
+		{token.EQ, "="},
+		{token.IDENT, "y2"},
+		{token.SEMI, ";"},
+		{token.IDENT, "a"},
+		{token.COALESCE, "??"},
+		{token.NULL, "null"},
+		{token.SEMI, ";"},
+		{token.IDENT, "h"},
+		{token.QUESTION, "?"},
+		{token.LBRACKET, "["},
+		{token.NUMBER, "0"},
+		{token.RBRACKET, "]"},
+		{token.SEMI, ";"},
+		{token.STRING, "foobar"},
+		{token.STRING, "foo bar"},
+		{token.STRING, "say \"hi\"\n"},
+		{token.STRING, "sum is "},
+		{token.INTERP_START, "${"},
+		{token.IDENT, "a"},
+		{token.PLUS, "+"},
+		{token.IDENT, "b"},
+		{token.INTERP_END, "}"},
+		{token.STRING, "!"},
+		{token.STRING, ""},
+		{token.INTERP_START, "${"},
+		{token.IDENT, "f"},
+		{token.LPAREN, "("},
+		{token.LBRACE, "{"},
+		{token.RBRACE, "}"},
+		{token.RPAREN, ")"},
+		{token.INTERP_END, "}"},
+		{token.STRING, ""},
+		{token.STRING, ""},
+		{token.INTERP_START, "${"},
+		{token.STRING, "in"},
+		{token.PLUS, "+"},
+		{token.STRING, ""},
+		{token.INTERP_START, "${"},
+		{token.IDENT, "x"},
+		{token.INTERP_END, "}"},
+		{token.STRING, ""},
+		{token.INTERP_END, "}"},
+		{token.STRING, ""},
+		{token.MATCH, "match"},
+		{token.IDENT, "x"},
+		{token.LBRACE, "{"},
+		{token.NUMBER, "1"},
+		{token.ARROW, "=>"},
+		{token.STRING, "one"},
+		{token.COMMA, ","},
+		{token.IDENT, "_"},
+		{token.ARROW, "=>"},
+		{token.STRING, "other"},
+		{token.RBRACE, "}"},
+		{token.NUMBER, "1"},
+		{token.RANGE, ".."},
+		{token.NUMBER, "10"},
+		{token.NUMBER, "2"},
+		{token.POW, "**"},
+		{token.NUMBER, "3"},
+		{token.POW, "**"},
+		{token.NUMBER, "2"},
+		{token.ASTERISK, "*"},
+		{token.NUMBER, "4"},
+		{token.IDENT, "a"},
+		{token.BIT_AND, "&"},
+		{token.IDENT, "b"},
+		{token.BIT_OR, "|"},
+		{token.IDENT, "c"},
+		{token.BIT_XOR, "^"},
+		{token.BIT_NOT, "~"},
+		{token.IDENT, "d"},
+		{token.SHL, "<<"},
+		{token.NUMBER, "1"},
+		{token.SHR, ">>"},
+		{token.NUMBER, "2"},
+		{token.LT, "<"},
+		{token.NUMBER, "3"},
+		{token.GT, ">"},
+		{token.NUMBER, "4"},
+		{token.IDENT, "a"},
+		{token.ILLEGAL, "&&"},
+		{token.IDENT, "b"},
+		{token.ILLEGAL, "||"},
+		{token.IDENT, "c"},
+		{token.LET, "let"},
+		{token.IDENT, "f"},
+		{token.COLON, ":"},
+		{token.FUNCTION, "fn"},
+		{token.EQ, "="},
+		{token.FUNCTION, "fn"},
+		{token.LPAREN, "("},
+		{token.IDENT, "x"},
+		{token.COLON, ":"},
+		{token.IDENT, "int"},
+		{token.RPAREN, ")"},
+		{token.THIN_ARROW, "->"},
+		{token.IDENT, "int"},
+		{token.LBRACE, "{"},
+		{token.IDENT, "x"},
+		{token.MINUS, "-"},
+		{token.MINUS, "-"},
+		{token.NUMBER, "1"},
+		{token.RBRACE, "}"},
+		{token.SEMI, ";"},
+		{token.FOR, "for"},
+		{token.LPAREN, "("},
+		{token.IDENT, "x"},
+		{token.IN, "in"},
+		{token.IDENT, "xs"},
+		{token.RPAREN, ")"},
+		{token.LBRACE, "{"},
+		{token.IDENT, "inner"},
+		{token.RBRACE, "}"},
+		{token.IDENT, "xs"},
+		{token.PIPE, "|>"},
+		{token.IDENT, "map"},
+		{token.LPAREN, "("},
+		{token.IDENT, "double"},
+		{token.RPAREN, ")"},
+		{token.BIT_OR, "|"},
+		{token.IDENT, "y"},
+		{token.LET, "let"},
+		{token.IDENT, "p"},
+		{token.EQ, "="},
+		{token.LBRACE, "{"},
+		{token.IDENT, "x"},
+		{token.COLON, ":"},
+		{token.NUMBER, "1"},
+		{token.RBRACE, "}"},
+		{token.SEMI, ";"},
+		{token.IDENT, "p"},
+		{token.DOT, "."},
+		{token.IDENT, "x"},
 		{token.EOF, ""},
 	}
 
@@ -135,3 +295,370 @@ let śńięg = 9;
 	}
 
 }
+
+func TestIdentifiers(t *testing.T) {
+	tests := []struct {
+		input           string
+		strict          bool
+		expectedKind    token.Kind
+		expectedLiteral string
+	}{
+		{"śńięg", false, token.IDENT, "śńięg"},
+		{"_foo_bar", false, token.IDENT, "_foo_bar"},
+		{"変数", false, token.IDENT, "変数"},
+		{"x\u0301", false, token.IDENT, "x\u0301"},      // combining mark
+		{"cafe\u0301", false, token.IDENT, "caf\u00e9"}, // NFC
+		{"∆", false, token.ILLEGAL, "∆"},
+		{"p\u0430ypal", false, token.IDENT, "p\u0430ypal"}, // Cyrillic а
+		{"p\u0430ypal", true, token.ILLEGAL, "p\u0430ypal"},
+		{"Ωμέγα", true, token.IDENT, "Ωμέγα"},
+		{"snake_case", true, token.IDENT, "snake_case"},
+		{"x1", false, token.IDENT, "x1"},
+		{"a1b2", false, token.IDENT, "a1b2"},
+		{"_1", false, token.IDENT, "_1"},
+		{"fn2", false, token.IDENT, "fn2"},
+		{"AZaz_09", true, token.IDENT, "AZaz_09"},
+		{"123", false, token.NUMBER, "123"},
+		{"1x", false, token.ILLEGAL, "1x"},
+		{"12ab3", false, token.ILLEGAL, "12ab3"},
+	}
+
+	for i, tt := range tests {
+		l := NewWithOptions(tt.input, Options{Strict: tt.strict})
+		tok := l.NextToken()
+
+		if tok.Kind != tt.expectedKind {
+			t.Errorf("tests[%d] - tokentype wrong for %q. expected=%q, got=%q",
+				i, tt.input, tt.expectedKind, tok.Kind)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Errorf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+		if tok.Offset != 0 {
+			t.Errorf("tests[%d] - position wrong. expected=0, got=%d", i, tok.Offset)
+		}
+		if tok := l.NextToken(); tok.Kind != token.EOF {
+			t.Errorf("tests[%d] - expected a single token, got=%+v", i, tok)
+		}
+	}
+}
+
+func TestIdentASCII(t *testing.T) {
+	// The ASCII fast path must agree with the Unicode properties.
+	for ch := rune(0); ch < utf8.RuneSelf; ch++ {
+		start := ch == '_' || unicode.In(ch, unicode.L, unicode.Nl, unicode.Other_ID_Start)
+		cont := start || unicode.In(ch, unicode.Mn, unicode.Mc, unicode.Nd, unicode.Pc, unicode.Other_ID_Continue)
+		if isIdentStart(ch) != start || isIdentContinue(ch) != cont {
+			t.Errorf("identifier classes of %q wrong. expected=%t %t, got=%t %t",
+				ch, start, cont, isIdentStart(ch), isIdentContinue(ch))
+		}
+	}
+}
+
+func TestCustomKeywords(t *testing.T) {
+	const WHEN token.Kind = "WHEN"
+
+	l := NewWithOptions("when let whenever", Options{Keywords: map[string]token.Kind{"when": WHEN}})
+	expected := []token.Kind{WHEN, token.LET, token.IDENT, token.EOF}
+	for i, kind := range expected {
+		if tok := l.NextToken(); tok.Kind != kind {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, kind, tok.Kind)
+		}
+	}
+
+	if tok := New("when").NextToken(); tok.Kind != token.IDENT {
+		t.Fatalf("option keyword leaked to other lexers, got=%q", tok.Kind)
+	}
+}
+
+func TestInsertSemis(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"let x = 5\nx", []string{"let", "x", "=", "5", "\n", "x"}},
+		{"let x = 5;\n", []string{"let", "x", "=", "5", ";"}},
+		{"let x = 5 +\n6\n", []string{"let", "x", "=", "5", "+", "6", "\n"}},
+		{"add(1,\n2) // done\n\n", []string{"add", "(", "1", ",", "2", ")", "\n"}},
+		{"let f = fn(x) {\n  return\n}\n", []string{"let", "f", "=", "fn", "(", "x", ")", "{", "return", "\n", "}", "\n"}},
+		{"\"${a\n}\"\ntrue", []string{"", "${", "a", "}", "", "\n", "true"}},
+	}
+
+	for i, tt := range tests {
+		l := NewWithOptions(tt.input, Options{InsertSemis: true})
+		var got []string
+		for tok := l.NextToken(); tok.Kind != token.EOF; tok = l.NextToken() {
+			if tok.Kind == token.SEMI && tok.Literal == "\n" && tok.Lineno != strings.Count(tt.input[:tok.Offset], "\n")+1 {
+				t.Errorf("tests[%d] - inserted semicolon %+v on wrong line", i, tok)
+			}
+			got = append(got, tok.Literal)
+		}
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("tests[%d] - tokens of %q wrong. expected=%q, got=%q", i, tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestPreamble(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedKind   token.Kind
+		expectedLineno int
+		expectedOffset int
+	}{
+		{"\uFEFFlet", token.LET, 1, 1},
+		{"#!/usr/bin/env monkey\nlet", token.LET, 2, 22},
+		{"\uFEFF#!/usr/bin/env monkey\r\nlet", token.LET, 2, 24},
+		{"#!", token.EOF, 1, 2},
+		{"let x #!", token.LET, 1, 0},
+		{"\n#!", token.ILLEGAL, 2, 1},
+	}
+
+	for i, tt := range tests {
+		tok := New(tt.input).NextToken()
+		if tok.Kind != tt.expectedKind || tok.Lineno != tt.expectedLineno || tok.Offset != tt.expectedOffset {
+			t.Errorf("tests[%d] - first token of %q wrong. expected=%s on line %d at %d, got=%+v",
+				i, tt.input, tt.expectedKind, tt.expectedLineno, tt.expectedOffset, tok)
+		}
+	}
+}
+
+func TestColumns(t *testing.T) {
+	tests := []struct {
+		input    string
+		tabWidth int
+		expected [][3]int // line, column and offset of each token up to EOF.
+	}{
+		{"let x", 0, [][3]int{{1, 1, 0}, {1, 5, 4}, {1, 6, 5}}},
+		{"a\n  b\n", 0, [][3]int{{1, 1, 0}, {2, 3, 4}, {3, 1, 6}}},
+		{"\tx", 0, [][3]int{{1, 2, 1}, {1, 3, 2}}},
+		{"\tx", 4, [][3]int{{1, 5, 1}, {1, 6, 2}}},
+		{"ab\tx\t\ty", 4, [][3]int{{1, 1, 0}, {1, 5, 3}, {1, 13, 6}, {1, 14, 7}}},
+		{"śńieg = \"€\" 世界", 0, [][3]int{{1, 1, 0}, {1, 7, 6}, {1, 9, 8}, {1, 13, 12}, {1, 15, 14}}},
+		{"\uFEFFx", 0, [][3]int{{1, 1, 1}, {1, 2, 2}}},
+		{"\"a\nb\" c", 0, [][3]int{{1, 1, 0}, {2, 4, 6}, {2, 5, 7}}},
+	}
+
+	for i, tt := range tests {
+		l := NewWithOptions(tt.input, Options{TabWidth: tt.tabWidth})
+		var got [][3]int
+		for {
+			tok := l.NextToken()
+			got = append(got, [3]int{tok.Lineno, tok.LineColumn, tok.Offset})
+			if tok.Kind == token.EOF {
+				break
+			}
+		}
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("tests[%d] - spans of %q wrong. expected=%v, got=%v", i, tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestDiagnose(t *testing.T) {
+	tests := []struct {
+		input        string
+		expectedCode string
+	}{
+		{"@", "illegal-character"},
+		{"1x", "illegal-identifier"},
+		{"&&", "reserved-operator"},
+		{`"abc`, "unterminated-string"},
+		{"x", ""},
+	}
+
+	for i, tt := range tests {
+		tok := New(tt.input).NextToken()
+		d, ok := Diagnose(tok)
+		if ok != (tt.expectedCode != "") || d.Code != tt.expectedCode {
+			t.Errorf("tests[%d] - Diagnose(%+v) wrong. expected=%q, got=%q (%t)",
+				i, tok, tt.expectedCode, d.Code, ok)
+		}
+		if ok && d.Length != len(tt.input) {
+			t.Errorf("tests[%d] - length wrong. expected=%d, got=%d", i, len(tt.input), d.Length)
+		}
+	}
+}
+
+func TestDocComments(t *testing.T) {
+	input := `// Not a doc comment.
+/// Adds two numbers.
+///
+///  Indented.
+let add = fn(x, y) { x + y }; // trailing
+/// Discarded by the next comment.
+// Plain.
+let x = 1;
+//// Four slashes are a doc comment too.
+let y = 2;
+/// A file header, ended by the blank line.
+
+/// Only this line documents z.
+let z = 3; /// Not a doc comment: it follows code.
+let w = 4;`
+	expected := map[int]string{
+		0:  "Adds two numbers.\n\n Indented.",
+		15: "",
+		20: "/ Four slashes are a doc comment too.",
+		25: "Only this line documents z.",
+		30: "",
+	}
+
+	toks := Tokenize(input)
+	for i, doc := range expected {
+		if toks[i].Kind != token.LET {
+			t.Fatalf("tokens[%d] - tokentype wrong. expected=%q, got=%q", i, token.LET, toks[i].Kind)
+		}
+		if toks[i].Doc != doc {
+			t.Errorf("tokens[%d] - doc wrong. expected=%q, got=%q", i, doc, toks[i].Doc)
+		}
+	}
+	for i, tok := range toks {
+		if _, ok := expected[i]; !ok && tok.Doc != "" {
+			t.Errorf("tokens[%d] - unexpected doc %q on %+v", i, tok.Doc, tok)
+		}
+	}
+
+	// The trailing comment is not attached to the inserted semicolon
+	// either.
+	l := NewWithOptions("let z = 3 /// Not a doc comment.\nlet w = 4\n", Options{InsertSemis: true})
+	for tok := l.NextToken(); tok.Kind != token.EOF; tok = l.NextToken() {
+		if tok.Doc != "" {
+			t.Errorf("unexpected doc %q on %+v with InsertSemis", tok.Doc, tok)
+		}
+	}
+}
+
+func TestUnterminatedString(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedLiteral string
+	}{
+		{`let s = "abc`, `"abc`},
+		{`let s = "a ${b`, `"a ${b`},
+		{`let s = "a ${b} c`, `"a ${b} c`},
+		{`let s = "a ${"b ${c`, `"a ${"b ${c`},
+		{`let s = "a ${"b`, `"a ${"b`},
+		{`let s = "a ${"b ${c} d`, `"a ${"b ${c} d`},
+	}
+
+	for i, tt := range tests {
+		l := New(tt.input)
+		tok := l.NextToken()
+		for tok.Kind != token.UNTERMINATED && tok.Kind != token.EOF {
+			tok = l.NextToken()
+		}
+		if tok.Kind != token.UNTERMINATED || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - unterminated string wrong. expected=%q %q, got=%q %q",
+				i, token.UNTERMINATED, tt.expectedLiteral, tok.Kind, tok.Literal)
+		}
+		if tok.Offset != 8 || tok.LineColumn != 9 {
+			t.Fatalf("tests[%d] - unterminated string not at its quote, got=%+v", i, tok.Span)
+		}
+		if tok := l.NextToken(); tok.Kind != token.EOF {
+			t.Fatalf("tests[%d] - expected EOF after unterminated string, got=%q", i, tok.Kind)
+		}
+	}
+}
+
+func FuzzNextToken(f *testing.F) {
+	seeds := []string{
+		"",
+		"let add = fn(x, y) { x + y; };",
+		"10 == 10; 10 != 9; a ?? b; h?[0]; 1..10",
+		`"sum is ${a + b}!" "${"in" + "${x}"}" "\\"`,
+		"let ∆ = 9; let śńięg = 9;",
+		"\"unterminated ${ {",
+		"match x { 1 => \"one\", _ => \"other\" }",
+		"/// Doc.\nlet x = 1; // trailing\n//",
+		"#!/usr/bin/env monkey\nlet x = 1;",
+	}
+	for _, seed := range seeds {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, input string) {
+		// The lexer works on runes, so invalid UTF-8 is already
+		// replaced by U+FFFD in what it sees.
+		runes := []rune(input)
+		isBlank := func(rs []rune) bool {
+			for i := 0; i < len(rs); i++ {
+				switch {
+				case rs[i] == ' ' || rs[i] == '\t' || rs[i] == '\n' || rs[i] == '\r':
+				case rs[i] == '/' && i+1 < len(rs) && rs[i+1] == '/':
+					for i < len(rs) && rs[i] != '\n' {
+						i++
+					}
+				default:
+					return false
+				}
+			}
+			return true
+		}
+
+		l := New(input)
+		end := 0 // end of the previous token in runes.
+		if len(runes) > 0 && runes[0] == '\uFEFF' {
+			end = 1
+		}
+		if end+1 < len(runes) && runes[end] == '#' && runes[end+1] == '!' {
+			for end < len(runes) && runes[end] != '\n' {
+				end++
+			}
+		}
+		for i := 0; ; i++ {
+			if i > 2*len(runes)+2 {
+				t.Fatalf("lexer did not terminate on %q", input)
+			}
+			tok := l.NextToken()
+			start := tok.Offset
+			// A string left open at the end of input yields a token
+			// spanning it again from its quote.
+			reopened := tok.Kind == token.UNTERMINATED && start < end
+			if (start < end && !reopened) || l.Offset() < start || l.Offset() > len(runes) {
+				t.Fatalf("token %+v out of order, previous token ended at %d", tok, end)
+			}
+			line, column := 1, 1
+			for k, r := range runes[:start] {
+				switch {
+				case r == '\n':
+					line, column = line+1, 1
+				case k > 0 || r != '\uFEFF':
+					column++
+				}
+			}
+			if tok.Lineno != line || tok.LineColumn != column {
+				t.Fatalf("token %+v not at %d:%d", tok, line, column)
+			}
+			if !reopened && !isBlank(runes[end:start]) {
+				t.Fatalf("non-whitespace %q skipped before %+v", string(runes[end:start]), tok)
+			}
+			end = l.Offset()
+			src := string(runes[start:end])
+
+			switch tok.Kind {
+			case token.EOF:
+				if end != len(runes) {
+					t.Fatalf("EOF before the end of input at %d", end)
+				}
+				return
+			case token.STRING:
+				// String segments decode escapes, so only their
+				// position is checked.
+			case token.IDENT:
+				// Identifiers are NFC normalized.
+				if norm.NFC.String(src) != tok.Literal {
+					t.Fatalf("identifier %+v does not match input %q", tok, src)
+				}
+			default:
+				if src != tok.Literal {
+					t.Fatalf("token %+v does not match input %q", tok, src)
+				}
+				if src == "" {
+					t.Fatalf("empty literal for %+v", tok)
+				}
+			}
+		}
+	})
+}
@@ -0,0 +1,130 @@
+package lexer
+
+import (
+	"github/com/styvane/monkey/token"
+	"strings"
+	"unicode/utf8"
+)
+
+// An Edit replaces the characters in [Start, End) of a document with
+// Text. Offsets count runes, like token spans.
+type Edit struct {
+	Start int
+	End   int
+	Text  string
+}
+
+// Tokenize returns all the tokens of input, ending with the EOF token.
+// They are in the order of NextToken, so an UNTERMINATED token may start
+// before the tokens preceding it.
+func Tokenize(input string) []token.Token {
+	return tokenize(New(input))
+}
+
+// tokenize reads the remaining tokens of l, ending with the EOF token.
+func tokenize(l *Lexer) []token.Token {
+	var toks []token.Token
+	for {
+		tok := l.NextToken()
+		toks = append(toks, tok)
+		if tok.Kind == token.EOF {
+			return toks
+		}
+	}
+}
+
+// Relex updates the tokens of a document after an edit. input is the
+// document after the edit and oldTokens its tokens before, as returned
+// by Tokenize. Only the region around the edit is lexed again: tokens
+// after it are reused, with their spans shifted, as soon as the lexer
+// is back in step with them. Both use the default Options.
+func Relex(input string, oldTokens []token.Token, edit Edit) []token.Token {
+	restartable := restartPoints(oldTokens)
+	restart := -1
+	for i, tok := range oldTokens {
+		if tok.Offset >= edit.Start {
+			break
+		}
+		if restartable[i] {
+			// The last token starting before the edit, since the edit
+			// may extend it.
+			restart = i
+		}
+	}
+	if restart <= 0 {
+		// The first token may also turn into a #! line, which only the
+		// start of the input skips.
+		return Tokenize(input)
+	}
+
+	from := oldTokens[restart]
+	l := &Lexer{input: []rune(input), readPosition: from.Offset, lineNumber: from.Lineno, column: from.LineColumn}
+	if from.Doc != "" {
+		l.doc = strings.Split(from.Doc, "\n")
+	}
+	l.readChar()
+	l.column = from.LineColumn // readChar advanced it past the previous character.
+
+	delta := utf8.RuneCountInString(edit.Text) - (edit.End - edit.Start)
+	editEnd := edit.Start + utf8.RuneCountInString(edit.Text) // in the new document.
+	toks := append([]token.Token(nil), oldTokens[:restart]...)
+	j := restart
+	for {
+		inStep := l.neutral()
+		tok := l.NextToken()
+		if inStep && tok.Offset >= editEnd {
+			for j < len(oldTokens) && oldTokens[j].Offset+delta < tok.Offset {
+				j += 1
+			}
+			if j < len(oldTokens) && oldTokens[j].Offset >= edit.End &&
+				oldTokens[j].Offset+delta == tok.Offset &&
+				oldTokens[j].Kind == tok.Kind && oldTokens[j].Literal == tok.Literal &&
+				oldTokens[j].Doc == tok.Doc && restartable[j] {
+				// Only the tokens left on the line of the edit move
+				// sideways.
+				line, lines := oldTokens[j].Lineno, tok.Lineno-oldTokens[j].Lineno
+				columns := tok.LineColumn - oldTokens[j].LineColumn
+				for _, old := range oldTokens[j:] {
+					column := old.LineColumn
+					if old.Lineno == line {
+						column += columns
+					}
+					old.Span = token.NewSpan(old.Lineno+lines, column, old.Offset+delta)
+					toks = append(toks, old)
+				}
+				return toks
+			}
+		}
+		toks = append(toks, tok)
+		if tok.Kind == token.EOF {
+			return toks
+		}
+	}
+}
+
+// restartPoints reports for each token whether the lexer is outside any
+// string literal when it reaches it, so that lexing can start there
+// afresh.
+func restartPoints(toks []token.Token) []bool {
+	points := make([]bool, len(toks))
+	nesting := 0
+	for i, tok := range toks {
+		// An interpolation start or the string segment right after an
+		// interpolation continue a literal.
+		points[i] = nesting == 0 && tok.Kind != token.INTERP_START &&
+			(i == 0 || toks[i-1].Kind != token.INTERP_END)
+		switch tok.Kind {
+		case token.INTERP_START:
+			nesting += 1
+		case token.INTERP_END:
+			nesting -= 1
+		}
+	}
+	return points
+}
+
+// neutral returns true if the lexer is between tokens outside any
+// string literal.
+func (l *Lexer) neutral() bool {
+	return len(l.interps) == 0 && !l.inString && !l.startInterp
+}
@@ -0,0 +1,69 @@
+package lexer
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestRelex(t *testing.T) {
+	tests := []struct {
+		input string
+		edit  Edit
+	}{
+		{"let x = 5;", Edit{8, 9, "10"}},
+		{"let x = 5;", Edit{0, 0, "let y = 1;\n"}},
+		{"let x = 5;\nlet y = 6;", Edit{4, 5, "abc"}},
+		{"let x = 5;\nlet y = 6;", Edit{9, 11, ""}},
+		{"a = = b", Edit{3, 4, ""}},
+		{"1 x", Edit{1, 2, ""}},
+		{`"sum is ${a + b}!"; x`, Edit{11, 12, "bc"}},
+		{`"sum is ${a}!"; x`, Edit{12, 13, `}" + "${`}},
+		{`"a" + b`, Edit{0, 0, `"`}},
+		{"fn(x) {\n  x + 1;\n}\nlet y = 2;", Edit{13, 14, "2\n\n"}},
+		{"/// a\nlet x = 1;", Edit{8, 9, "yz"}},
+		{"let x = 1;\n/// a\nlet y = 1;", Edit{14, 15, "b"}},
+		{"x / y; z", Edit{3, 3, "/"}},
+	}
+
+	for i, tt := range tests {
+		old := Tokenize(tt.input)
+		input := applyEdit(tt.input, tt.edit)
+		got := Relex(input, old, tt.edit)
+		expected := Tokenize(input)
+		if !reflect.DeepEqual(got, expected) {
+			t.Errorf("tests[%d] - Relex(%q) wrong.\nexpected=%+v\ngot=%+v", i, input, expected, got)
+		}
+	}
+}
+
+func TestRelexRandomEdits(t *testing.T) {
+	input := "/// Adds.\nlet add = fn(x, y) {\n  x + y; // sum\n};\nlet s = \"${add(1, 2)} and ${\"x\"}\";\nmatch s { 1 => a ?? b, _ => 1..10 }\n"
+	fragments := []string{"", " ", "\n", "x", "1", "=", "\"", "${", "}", "{", "let ", "śń", "+", "//", "/// doc\n", "\t", "#!"}
+	rnd := rand.New(rand.NewSource(1))
+
+	toks := Tokenize(input)
+	for i := 0; i < 2000; i++ {
+		runes := []rune(input)
+		start := rnd.Intn(len(runes) + 1)
+		end := start + rnd.Intn(len(runes)-start+1)
+		if end-start > 4 {
+			end = start + 4
+		}
+		edit := Edit{start, end, fragments[rnd.Intn(len(fragments))]}
+		next := applyEdit(input, edit)
+
+		got := Relex(next, toks, edit)
+		expected := Tokenize(next)
+		if !reflect.DeepEqual(got, expected) {
+			t.Fatalf("edit %d %+v of %q wrong.\nexpected=%+v\ngot=%+v", i, edit, input, expected, got)
+		}
+		input, toks = next, got
+	}
+}
+
+// applyEdit returns input with the edit applied.
+func applyEdit(input string, edit Edit) string {
+	runes := []rune(input)
+	return string(runes[:edit.Start]) + edit.Text + string(runes[edit.End:])
+}
@@ -0,0 +1,49 @@
+/// Functions over arrays, written in Monkey itself.
+
+/// map returns the array of f applied to each element of xs.
+let map = fn(xs, f) {
+    let iter = fn(xs, acc) {
+        if (len(xs) == 0) {
+            acc
+        } else {
+            iter(rest(xs), push(acc, f(first(xs))));
+        }
+    };
+    iter(xs, []);
+};
+
+/// reduce folds xs from the left, starting with initial.
+let reduce = fn(xs, initial, f) {
+    let iter = fn(xs, result) {
+        if (len(xs) == 0) {
+            result
+        } else {
+            iter(rest(xs), f(result, first(xs)));
+        }
+    };
+    iter(xs, initial);
+};
+
+/// sum adds up the numbers in xs.
+let sum = fn(xs) {
+    reduce(xs, 0, fn(initial, el) { initial + el });
+};
+
+let double = fn(x) { x * 2 };
+let total = [1, 2, 3, 4] |> map(double) |> sum();
+
+let describe = fn(n) {
+    match n - n / 3 * 3 {
+        0 => "fizz",
+        _ => "${n} is not a multiple of three",
+    }
+};
+
+let people = [{"name": "Alice", "age": 24}, {"name": "Anna", "age": 28}];
+let getName = fn(person) { person["name"] ?? "nobody" };
+let names = map(people, getName);
+
+// Bit twiddling and ranges.
+let mask = (1 << 4) - 1 & ~0 ^ 3 | 8 >> 1;
+let squares = map(1..10, fn(x) { x ** 2 });
+let greeting = "Hello ${names[0]}, you are ${people[0]["age"]}!\n";
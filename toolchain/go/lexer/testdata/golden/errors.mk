@@ -0,0 +1,4 @@
+let 1x = @;
+let a = b && c || d;
+let pаypal = 1;
+let s = "unterminated ${name
@@ -0,0 +1,5 @@
+#!/usr/bin/env monkey
+/// The answer.
+let answer = 42; // not a doc comment
+	let tabbed = [1, 2, 3];
+let śnieg = 世界 ?? null;
@@ -0,0 +1,4 @@
+let name = "Monkey";
+let greeting = "Hello, ${name}!\n";
+let nested = "${"in" + "${name}"}";
+let escaped = "say \"hi\" for \$5\t\\";
@@ -0,0 +1,136 @@
+package repl
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"unicode"
+
+	"github.com/peterh/liner"
+)
+
+// HISTORY_FILE is the name of the history file in the user's home directory.
+const HISTORY_FILE = ".monkey_history"
+
+// A lineReader reads input lines for the REPL.
+type lineReader interface {
+	// readLine displays the prompt and returns the next line of input.
+	// It returns io.EOF when there is no more input and errAborted when
+	// the user aborts the line.
+	readLine(prompt string) (string, error)
+	close() error
+}
+
+// errAborted is returned by readLine when the line is aborted with
+// Ctrl-C.
+var errAborted = errors.New("aborted")
+
+// A completer returns the completion candidates for a word prefix.
+type completer func(prefix string) []string
+
+// newLineReader returns a line editor when in is an interactive terminal
+// and a plain line scanner otherwise. The scanner displays prompts
+// through decorate, which the line editor cannot do.
+func newLineReader(in io.Reader, out io.Writer, complete completer, decorate func(string) string) lineReader {
+	if f, ok := in.(*os.File); ok && f == os.Stdin && isTerminal(f) && liner.TerminalSupported() {
+		return newLineEditor(complete)
+	}
+	return &scannerReader{scanner: bufio.NewScanner(in), out: out, decorate: decorate}
+}
+
+// isTerminal returns true if f is a terminal. liner.TerminalSupported
+// only looks at $TERM, so piped input would otherwise be read, and
+// saved in the history, by the line editor.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// scannerReader reads lines from a non-interactive input.
+type scannerReader struct {
+	scanner  *bufio.Scanner
+	out      io.Writer
+	decorate func(prompt string) string
+}
+
+func (r *scannerReader) readLine(prompt string) (string, error) {
+	fmt.Fprint(r.out, r.decorate(prompt))
+	if !r.scanner.Scan() {
+		if err := r.scanner.Err(); err != nil {
+			return "", err
+		}
+		return "", io.EOF
+	}
+	return r.scanner.Text(), nil
+}
+
+func (r *scannerReader) close() error { return nil }
+
+// lineEditor reads lines from the terminal with line editing and a
+// history persisted across sessions.
+type lineEditor struct {
+	state       *liner.State
+	historyPath string
+}
+
+func newLineEditor(complete completer) *lineEditor {
+	e := &lineEditor{state: liner.NewLiner()}
+	e.state.SetCtrlCAborts(true)
+	e.state.SetTabCompletionStyle(liner.TabPrints)
+	e.state.SetWordCompleter(func(line string, pos int) (string, []string, string) {
+		runes := []rune(line)
+		start := pos
+		for start > 0 && isWordChar(runes[start-1]) {
+			start -= 1
+		}
+		if start > 0 && runes[start-1] == ':' {
+			start -= 1
+		}
+		return string(runes[:start]), complete(string(runes[start:pos])), string(runes[pos:])
+	})
+	if home, err := os.UserHomeDir(); err == nil {
+		e.historyPath = filepath.Join(home, HISTORY_FILE)
+		if f, err := os.Open(e.historyPath); err == nil {
+			e.state.ReadHistory(f)
+			f.Close()
+		}
+	}
+	return e
+}
+
+// isWordChar returns true if the character can be part of a completed word.
+func isWordChar(ch rune) bool {
+	return unicode.IsLetter(ch) || unicode.IsDigit(ch) || ch == '_'
+}
+
+func (e *lineEditor) readLine(prompt string) (string, error) {
+	line, err := e.state.Prompt(prompt)
+	if err == liner.ErrPromptAborted {
+		return "", errAborted
+	}
+	if err != nil {
+		return "", err
+	}
+	if line != "" {
+		e.state.AppendHistory(line)
+	}
+	return line, nil
+}
+
+// close restores the terminal and saves the history.
+func (e *lineEditor) close() error {
+	defer e.state.Close()
+	if e.historyPath == "" {
+		return nil
+	}
+	f, err := os.Create(e.historyPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = e.state.WriteHistory(f)
+	return err
+}
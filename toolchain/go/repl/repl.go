@@ -2,28 +2,370 @@
 package repl
 
 import (
-	"bufio"
 	"fmt"
+	"github/com/styvane/monkey/diagnostics"
+	"github/com/styvane/monkey/highlight"
 	"github/com/styvane/monkey/lexer"
 	"github/com/styvane/monkey/token"
 	"io"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
 )
 
-const PROMPT = ">>> "
+const (
+	PROMPT      = ">>> "
+	CONT_PROMPT = "... "
+)
+
+// Options configures a REPL.
+type Options struct {
+	// Color enables ANSI colors in prompts, results and error messages,
+	// and echoes each input with syntax highlighting. The line editor
+	// cannot show colored prompts, so they are only colored when the
+	// input is not a terminal.
+	Color bool
+}
+
+// ANSI escape sequences used with Color.
+const (
+	promptColor = "\x1b[1;34m"
+	errorColor  = "\x1b[1;31m"
+	reset       = "\x1b[0m"
+)
+
+// A session holds the state of a running REPL.
+type session struct {
+	in    lineReader // set by Start.
+	out   io.Writer
+	color bool
+	quit  bool
+	names map[string]bool // names bound with let during the session.
+	// The inputs evaluated without error, for :save.
+	history []string
+	timing  bool // print the time and allocations of each input.
+}
+
+// A command is a colon-prefixed REPL meta command.
+type command struct {
+	help string
+	run  func(s *session, arg string)
+}
+
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"quit":   {"exit the REPL", func(s *session, _ string) { s.quit = true }},
+		"help":   {"show this help", (*session).help},
+		"load":   {"load a source file (:load path/to/file.mk)", (*session).load},
+		"paste":  {"read a block until :end or Ctrl-D and process it as a whole", (*session).paste},
+		"time":   {"toggle the display of the time and memory taken by each input", (*session).toggleTiming},
+		"save":   {"save the session inputs to a file (:save session.mk)", (*session).save},
+		"replay": {"start over from a saved session (:replay session.mk)", (*session).replay},
+	}
+}
 
+// Start runs the REPL until the input is exhausted or the user quits.
+// Line editing and history are enabled when in is the terminal.
 func Start(in io.Reader, out io.Writer) {
-	scanner := bufio.NewScanner(in)
+	StartWithOptions(in, out, Options{})
+}
+
+// StartWithOptions runs the REPL like Start, using opts.
+func StartWithOptions(in io.Reader, out io.Writer, opts Options) {
+	s := &session{out: out, color: opts.Color, names: make(map[string]bool)}
+	prompt := func(p string) string { return s.paint(promptColor, p) }
+	s.in = newLineReader(in, out, s.complete, prompt)
+	defer s.in.close()
+	s.run()
+}
+
+// run reads and processes inputs until the end of input or :quit. An
+// aborted line discards the input read so far, so that Ctrl-C gets out
+// of a continuation buffer without ending the session.
+func (s *session) run() {
+	var input strings.Builder
+	for !s.quit {
+		prompt := PROMPT
+		if input.Len() > 0 {
+			prompt = CONT_PROMPT
+		}
+		line, err := s.in.readLine(prompt)
+		if err == errAborted {
+			input.Reset()
+			continue
+		}
+		if err != nil {
+			return
+		}
+		if input.Len() == 0 && strings.HasPrefix(line, ":") {
+			s.command(line[1:])
+			continue
+		}
+		input.WriteString(line)
+		input.WriteString("\n")
+		if isIncomplete(input.String()) {
+			continue
+		}
+
+		s.eval(typedInput, input.String())
+		input.Reset()
+	}
+}
+
+// typedInput is the source name of the inputs typed or pasted in the
+// REPL, used in diagnostics.
+const typedInput = "<input>"
+
+// eval processes a complete input read from the named source. Newlines
+// end statements, so that lines need no semicolon. Inputs without errors
+// are added to the session history, and the names they bind to the
+// completion candidates.
+func (s *session) eval(name, input string) {
+	if s.timing {
+		defer s.measure()()
+	}
+	if s.color {
+		highlight.ANSI(s.out, input)
+	}
+	l := lexer.NewWithOptions(input, lexer.Options{InsertSemis: true})
+	var prev token.Kind
+	var names []string
+	var diags []diagnostics.Diagnostic
+	for tok := l.NextToken(); tok.Kind != token.EOF; tok = l.NextToken() {
+		if prev == token.LET && tok.Kind == token.IDENT {
+			names = append(names, tok.Literal)
+		}
+		if d, ok := lexer.Diagnose(tok); ok {
+			diags = append(diags, d)
+		}
+		prev = tok.Kind
+		result := formatToken(tok)
+		if s.color {
+			result = highlight.Paint(highlight.Classify(tok.Kind), result)
+		}
+		fmt.Fprintln(s.out, result)
+	}
+	if len(diags) > 0 {
+		diagnostics.Terminal{Filename: name, Source: input, Color: s.color}.Render(s.out, diags)
+		return
+	}
+	s.history = append(s.history, strings.TrimRight(input, "\n"))
+	for _, name := range names {
+		s.names[name] = true
+	}
+}
+
+// formatToken returns the line printed for tok. It shows the kind,
+// literal and span of the token, in the form %+v used to give, but not
+// its doc comment.
+func formatToken(tok token.Token) string {
+	return fmt.Sprintf("{Kind:%s Literal:%s Span:{Lineno:%d LineColumn:%d Offset:%d}}",
+		tok.Kind, tok.Literal, tok.Lineno, tok.LineColumn, tok.Offset)
+}
+
+// paint returns text in color if colors are enabled.
+func (s *session) paint(color, text string) string {
+	if !s.color || text == "" {
+		return text
+	}
+	return color + text + reset
+}
+
+// errorf prints an error message.
+func (s *session) errorf(format string, args ...interface{}) {
+	fmt.Fprintln(s.out, s.paint(errorColor, fmt.Sprintf(format, args...)))
+}
+
+// measure starts measuring a computation and returns the function that
+// stops and prints its wall time and allocations.
+func (s *session) measure() func() {
+	var before runtime.MemStats
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+	return func() {
+		elapsed := time.Since(start)
+		var after runtime.MemStats
+		runtime.ReadMemStats(&after)
+		fmt.Fprintf(s.out, "(%v, %s in %d allocations)\n", elapsed.Round(time.Microsecond),
+			formatBytes(after.TotalAlloc-before.TotalAlloc), after.Mallocs-before.Mallocs)
+	}
+}
+
+// formatBytes returns n in bytes, KiB or MiB.
+func formatBytes(n uint64) string {
+	switch {
+	case n < 1<<10:
+		return fmt.Sprintf("%d B", n)
+	case n < 1<<20:
+		return fmt.Sprintf("%.1f KiB", float64(n)/(1<<10))
+	default:
+		return fmt.Sprintf("%.1f MiB", float64(n)/(1<<20))
+	}
+}
+
+// complete returns the sorted keywords, meta commands and bound names
+// starting with prefix.
+func (s *session) complete(prefix string) []string {
+	var candidates []string
+	if strings.HasPrefix(prefix, ":") {
+		for name := range commands {
+			candidates = append(candidates, ":"+name)
+		}
+	} else {
+		candidates = token.Keywords()
+		for name := range s.names {
+			candidates = append(candidates, name)
+		}
+	}
+
+	var matches []string
+	for _, c := range candidates {
+		if strings.HasPrefix(c, prefix) {
+			matches = append(matches, c)
+		}
+	}
+	sort.Strings(matches)
+	return matches
+}
+
+// command runs the meta command in line.
+func (s *session) command(line string) {
+	name, arg, _ := strings.Cut(strings.TrimSpace(line), " ")
+	cmd, ok := commands[name]
+	if !ok {
+		s.errorf("unknown command :%s (type :help for a list)", name)
+		return
+	}
+	cmd.run(s, strings.TrimSpace(arg))
+}
+
+// help prints the list of meta commands.
+func (s *session) help(_ string) {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(s.out, "  :%-8s %s\n", name, commands[name].help)
+	}
+}
+
+// toggleTiming turns the display of the time and memory taken by each
+// input on or off.
+func (s *session) toggleTiming(_ string) {
+	s.timing = !s.timing
+	if s.timing {
+		fmt.Fprintln(s.out, "timing on")
+	} else {
+		fmt.Fprintln(s.out, "timing off")
+	}
+}
+
+// load reads the source file at path and processes it as REPL input.
+func (s *session) load(path string) {
+	if path == "" {
+		fmt.Fprintln(s.out, "usage: :load path/to/file.mk")
+		return
+	}
+	src, err := os.ReadFile(path)
+	if err != nil {
+		s.errorf("cannot load %s: %v", path, err)
+		return
+	}
+	s.eval(path, string(src))
+}
+
+// paste reads lines up to a line holding :end, or the end of input, and
+// processes them as a single input, so that a multi-statement snippet can
+// be pasted without being split at each complete line. An aborted line
+// discards the block.
+func (s *session) paste(_ string) {
+	fmt.Fprintln(s.out, "(paste mode: finish with :end or Ctrl-D, discard with Ctrl-C)")
+	var input strings.Builder
 	for {
-		fmt.Fprintf(out, PROMPT)
-		scanned := scanner.Scan()
-		if !scanned {
+		line, err := s.in.readLine("")
+		if err == errAborted {
+			fmt.Fprintln(s.out, "(paste discarded)")
 			return
 		}
-		line := scanner.Text()
-		l := lexer.New(line)
-		for tok := l.NextToken(); tok.Kind != token.EOF; tok = l.NextToken() {
-			fmt.Fprintf(out, "%+v\n", tok)
+		if err != nil || strings.TrimSpace(line) == ":end" {
+			break
 		}
+		input.WriteString(line)
+		input.WriteString("\n")
+	}
+	if strings.TrimSpace(input.String()) == "" {
+		return
+	}
+	s.eval(typedInput, input.String())
+}
+
+// save writes the inputs evaluated without error so far to path, one
+// after the other, so that :replay can restore the session.
+func (s *session) save(path string) {
+	if path == "" {
+		fmt.Fprintln(s.out, "usage: :save session.mk")
+		return
+	}
+	var src strings.Builder
+	for _, input := range s.history {
+		src.WriteString(input)
+		src.WriteString("\n")
+	}
+	if err := os.WriteFile(path, []byte(src.String()), 0o644); err != nil {
+		s.errorf("cannot save %s: %v", path, err)
+	}
+}
 
+// replay discards the state of the session and processes the source file
+// at path, usually written by :save.
+func (s *session) replay(path string) {
+	if path == "" {
+		fmt.Fprintln(s.out, "usage: :replay session.mk")
+		return
+	}
+	src, err := os.ReadFile(path)
+	if err != nil {
+		s.errorf("cannot replay %s: %v", path, err)
+		return
+	}
+	s.names = make(map[string]bool)
+	s.history = nil
+	s.eval(path, string(src))
+}
+
+// isIncomplete returns true if the input has unbalanced delimiters or
+// ends with an operator, meaning more lines are expected.
+func isIncomplete(input string) bool {
+	depth := 0
+	var last token.Kind
+	l := lexer.New(input)
+	for tok := l.NextToken(); tok.Kind != token.EOF; tok = l.NextToken() {
+		switch tok.Kind {
+		case token.LPAREN, token.LBRACE, token.LBRACKET:
+			depth += 1
+		case token.RPAREN, token.RBRACE, token.RBRACKET:
+			depth -= 1
+		case token.UNTERMINATED:
+			return true
+		}
+		last = tok.Kind
+	}
+	if depth > 0 {
+		return true
+	}
+	switch last {
+	case token.EQ, token.PLUS, token.MINUS, token.NOT, token.ASTERISK, token.POW,
+		token.SLASH, token.LT, token.GT, token.EQEQ, token.NE, token.COALESCE, token.ARROW, token.RANGE,
+		token.BIT_AND, token.BIT_OR, token.BIT_XOR, token.BIT_NOT, token.SHL, token.SHR, token.COMMA,
+		token.COLON, token.THIN_ARROW, token.PIPE, token.DOT:
+		return true
+	default:
+		return false
 	}
 }
@@ -0,0 +1,266 @@
+package repl
+
+import (
+	"github/com/styvane/monkey/token"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestIsIncomplete(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"let x = 5;", false},
+		{"let add = fn(x, y) {", true},
+		{"let add = fn(x, y) {\nx + y;\n};", false},
+		{"add(1,", true},
+		{"let x = 5 +", true},
+		{"let x =", true},
+		{"[1, 2, 3] |>", true},
+		{"[1, 2", true},
+		{"}", false},
+		{`let s = "abc`, true},
+		{`let s = "abc";`, false},
+		{`let s = "${x} abc`, true},
+		{`let s = "${x`, true},
+		{"", false},
+	}
+
+	for i, tt := range tests {
+		if got := isIncomplete(tt.input); got != tt.expected {
+			t.Errorf("tests[%d] - isIncomplete(%q) wrong. expected=%t, got=%t",
+				i, tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestComplete(t *testing.T) {
+	s := &session{out: io.Discard, names: make(map[string]bool)}
+	s.eval(typedInput, "let five = 5; let fizz = fn(x) { x };")
+
+	tests := []struct {
+		prefix   string
+		expected []string
+	}{
+		{"f", []string{"false", "five", "fizz", "fn", "for"}},
+		{"re", []string{"return"}},
+		{":q", []string{":quit"}},
+		{"x", nil},
+	}
+
+	for i, tt := range tests {
+		got := s.complete(tt.prefix)
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("tests[%d] - complete(%q) wrong. expected=%q, got=%q",
+				i, tt.prefix, tt.expected, got)
+		}
+	}
+}
+
+func TestSaveReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.mk")
+	s := &session{out: io.Discard, names: make(map[string]bool)}
+	s.eval(typedInput, "let five = 5;\n")
+	s.eval(typedInput, "let bad = @;\n")
+	s.eval(typedInput, "let add = fn(x, y) {\n x + y\n};\n")
+	s.save(path)
+
+	src, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "let five = 5;\nlet add = fn(x, y) {\n x + y\n};\n"
+	if string(src) != expected {
+		t.Fatalf("saved session wrong. expected=%q, got=%q", expected, src)
+	}
+
+	expectedNames := map[string]bool{"five": true, "add": true}
+	if !reflect.DeepEqual(s.names, expectedNames) {
+		t.Errorf("names wrong. expected=%v, got=%v", expectedNames, s.names)
+	}
+
+	r := &session{out: io.Discard, names: map[string]bool{"stale": true}}
+	r.replay(path)
+	if !reflect.DeepEqual(r.names, expectedNames) {
+		t.Errorf("replayed names wrong. expected=%v, got=%v", expectedNames, r.names)
+	}
+}
+
+func TestDiagnosticFilename(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "c.mk")
+	if err := os.WriteFile(path, []byte("let a = 1;\nlet b = @;\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		command  string
+		expected string
+	}{
+		{"load " + path, path + ":2:9"},
+		{"replay " + path, path + ":2:9"},
+	}
+
+	for i, tt := range tests {
+		var out strings.Builder
+		s := &session{out: &out, names: make(map[string]bool)}
+		s.command(tt.command)
+		if !strings.Contains(out.String(), tt.expected) {
+			t.Errorf("tests[%d] - diagnostic wrong. expected to contain %q, got=%q",
+				i, tt.expected, out.String())
+		}
+	}
+
+	var out strings.Builder
+	s := &session{out: &out, names: make(map[string]bool)}
+	s.eval(typedInput, "let b = @;\n")
+	if !strings.Contains(out.String(), "<input>:1:9") {
+		t.Errorf("diagnostic of typed input wrong. got=%q", out.String())
+	}
+}
+
+func TestPaste(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.mk")
+	input := ":paste\nlet a = 1\n\nlet b = fn(x) {\n:end\n:save " + path + "\n"
+	Start(strings.NewReader(input), io.Discard)
+
+	src, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A block that would not be complete line by line is still
+	// processed as one input.
+	expected := "let a = 1\n\nlet b = fn(x) {\n"
+	if string(src) != expected {
+		t.Errorf("pasted input wrong. expected=%q, got=%q", expected, src)
+	}
+}
+
+// ctrlC is a fakeReader line that is aborted.
+const ctrlC = "\x03"
+
+// fakeReader returns its lines, then err.
+type fakeReader struct {
+	lines []string
+	err   error
+}
+
+func (r *fakeReader) readLine(string) (string, error) {
+	if len(r.lines) == 0 {
+		return "", r.err
+	}
+	line := r.lines[0]
+	r.lines = r.lines[1:]
+	if line == ctrlC {
+		return "", errAborted
+	}
+	return line, nil
+}
+
+func (r *fakeReader) close() error { return nil }
+
+func TestPasteEnd(t *testing.T) {
+	tests := []struct {
+		lines           []string
+		err             error
+		expectedHistory []string
+	}{
+		{[]string{"let a = 1"}, io.EOF, []string{"let a = 1"}},
+		{[]string{"let a = 1"}, errAborted, nil},
+		{[]string{"let a = 1", ":end"}, errAborted, []string{"let a = 1"}},
+		{[]string{"", "  ", ":end"}, io.EOF, nil},
+		{nil, io.EOF, nil},
+	}
+
+	for i, tt := range tests {
+		s := &session{in: &fakeReader{tt.lines, tt.err}, out: io.Discard, names: make(map[string]bool)}
+		s.command("paste")
+		if !reflect.DeepEqual(s.history, tt.expectedHistory) {
+			t.Errorf("tests[%d] - history wrong. expected=%q, got=%q", i, tt.expectedHistory, s.history)
+		}
+	}
+}
+
+func TestAbort(t *testing.T) {
+	tests := []struct {
+		lines           []string
+		expectedHistory []string
+	}{
+		{[]string{"let a = 1", ctrlC, "let b = 2"}, []string{"let a = 1", "let b = 2"}},
+		{[]string{"let f = fn(x) {", `"abc`, ctrlC, "let c = 3"}, []string{"let c = 3"}},
+		{[]string{"let s = (", ctrlC, ":quit", "let d = 4"}, nil},
+	}
+
+	for i, tt := range tests {
+		s := &session{in: &fakeReader{tt.lines, io.EOF}, out: io.Discard, names: make(map[string]bool)}
+		s.run()
+		if !reflect.DeepEqual(s.history, tt.expectedHistory) {
+			t.Errorf("tests[%d] - history wrong. expected=%q, got=%q", i, tt.expectedHistory, s.history)
+		}
+	}
+}
+
+func TestTiming(t *testing.T) {
+	var out strings.Builder
+	s := &session{out: &out, names: make(map[string]bool)}
+	s.command("time")
+	s.eval(typedInput, "let x = 1;\n")
+	s.command("time")
+	s.eval(typedInput, "let y = 2;\n")
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	timed := regexp.MustCompile(`^\([0-9.]+[µnm]?s, [0-9.]+ (B|KiB|MiB) in [0-9]+ allocations\)$`)
+	var reports []string
+	for _, line := range lines {
+		if timed.MatchString(line) {
+			reports = append(reports, line)
+		}
+	}
+	if lines[0] != "timing on" || len(reports) != 1 || !strings.Contains(out.String(), "timing off") {
+		t.Errorf("timing output wrong. got=%q", out.String())
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := []struct {
+		n        uint64
+		expected string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1536, "1.5 KiB"},
+		{3 << 20, "3.0 MiB"},
+	}
+
+	for i, tt := range tests {
+		if got := formatBytes(tt.n); got != tt.expected {
+			t.Errorf("tests[%d] - formatBytes(%d) wrong. expected=%q, got=%q", i, tt.n, tt.expected, got)
+		}
+	}
+}
+
+func TestFormatToken(t *testing.T) {
+	tok := token.Token{Kind: token.LET, Literal: "let", Span: token.NewSpan(2, 3, 14), Doc: "Adds."}
+	expected := "{Kind:LET Literal:let Span:{Lineno:2 LineColumn:3 Offset:14}}"
+	if got := formatToken(tok); got != expected {
+		t.Errorf("formatToken wrong. expected=%q, got=%q", expected, got)
+	}
+}
+
+func TestColor(t *testing.T) {
+	for _, color := range []bool{false, true} {
+		var out strings.Builder
+		StartWithOptions(strings.NewReader("let x = 1x\n:nope\n"), &out, Options{Color: color})
+		if got := strings.Contains(out.String(), "\x1b["); got != color {
+			t.Errorf("colors wrong with Color=%t. got=%q", color, out.String())
+		}
+		if !strings.Contains(out.String(), "illegal identifier") {
+			t.Errorf("missing diagnostic with Color=%t. got=%q", color, out.String())
+		}
+	}
+}
@@ -0,0 +1,200 @@
+// Package source implements file sets, which map compact positions to
+// file names, lines and columns.
+//
+// A Pos is a single integer, cheap to store in every node or
+// instruction. It is resolved to a Position only when one is printed,
+// using the line table of the file it belongs to.
+package source
+
+import (
+	"fmt"
+	"github/com/styvane/monkey/token"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Pos is a position in a FileSet. It is the offset of a character in its
+// file, counting runes, plus the base of the file.
+type Pos int
+
+// NoPos is the zero Pos, which is in no file.
+const NoPos Pos = 0
+
+// IsValid returns true if p is not NoPos.
+func (p Pos) IsValid() bool {
+	return p != NoPos
+}
+
+// Position is a resolved Pos.
+type Position struct {
+	Filename string
+	Line     int // from 1.
+	Column   int // from 1, counting runes.
+	Offset   int // from 0, counting runes.
+}
+
+// IsValid returns true if the position has a line.
+func (p Position) IsValid() bool {
+	return p.Line > 0
+}
+
+// String returns the position as "file:line:col", "line:col" without a
+// file name, or "-" if it is not valid.
+func (p Position) String() string {
+	if !p.IsValid() {
+		return "-"
+	}
+	if p.Filename == "" {
+		return fmt.Sprintf("%d:%d", p.Line, p.Column)
+	}
+	return fmt.Sprintf("%s:%d:%d", p.Filename, p.Line, p.Column)
+}
+
+// A File is a file of a FileSet.
+type File struct {
+	name     string
+	base     int
+	size     int
+	lines    []int // offset of the first character of each line.
+	bom      bool  // the file starts with a byte order mark.
+	tabWidth int   // distance between tab stops, or 0.
+	tabs     []int // offset of each tab, if tabWidth is set.
+}
+
+// Name returns the file name given to AddFile.
+func (f *File) Name() string {
+	return f.name
+}
+
+// Base returns the Pos of the first character of the file.
+func (f *File) Base() int {
+	return f.base
+}
+
+// Size returns the length of the file in runes.
+func (f *File) Size() int {
+	return f.size
+}
+
+// LineCount returns the number of lines in the file.
+func (f *File) LineCount() int {
+	return len(f.lines)
+}
+
+// Pos returns the Pos of offset in the file. It panics if offset is
+// beyond the end of the file; the end itself is a valid position.
+func (f *File) Pos(offset int) Pos {
+	if offset < 0 || offset > f.size {
+		panic(fmt.Sprintf("source: offset %d out of range [0, %d] in %s", offset, f.size, f.name))
+	}
+	return Pos(f.base + offset)
+}
+
+// Offset returns the offset of p in the file. It panics if p is not in
+// the file.
+func (f *File) Offset(p Pos) int {
+	if int(p) < f.base || int(p) > f.base+f.size {
+		panic(fmt.Sprintf("source: position %d not in %s", p, f.name))
+	}
+	return int(p) - f.base
+}
+
+// Position resolves p, which must be in the file.
+func (f *File) Position(p Pos) Position {
+	offset := f.Offset(p)
+	line := sort.Search(len(f.lines), func(i int) bool { return f.lines[i] > offset })
+	return Position{
+		Filename: f.name,
+		Line:     line,
+		Column:   f.column(f.lines[line-1], offset),
+		Offset:   offset,
+	}
+}
+
+// column returns the column of offset in the line starting at start,
+// counting columns like the lexer.
+func (f *File) column(start, offset int) int {
+	if f.bom && start == 0 && offset > 0 {
+		// The mark takes no column.
+		start = 1
+	}
+	column := 1
+	i := sort.SearchInts(f.tabs, start)
+	for ; i < len(f.tabs) && f.tabs[i] < offset; i++ {
+		column += f.tabs[i] - start
+		column += f.tabWidth - (column-1)%f.tabWidth
+		start = f.tabs[i] + 1
+	}
+	return column + offset - start
+}
+
+// Span returns the token span of p, which must be in the file. It is the
+// span the lexer gives the token at p when its TabWidth is that of the
+// file.
+func (f *File) Span(p Pos) token.Span {
+	pos := f.Position(p)
+	return token.NewSpan(pos.Line, pos.Column, pos.Offset)
+}
+
+// A FileSet is a set of files whose positions do not overlap, so that a
+// Pos alone identifies its file. It is safe for concurrent use.
+type FileSet struct {
+	mu    sync.RWMutex
+	base  int // base of the next file.
+	files []*File
+}
+
+// NewFileSet returns an empty file set.
+func NewFileSet() *FileSet {
+	return &FileSet{base: 1}
+}
+
+// AddFile adds the file with the given name and contents to the set and
+// returns it. A tab counts as one column.
+func (s *FileSet) AddFile(filename, src string) *File {
+	return s.AddFileWithTabWidth(filename, src, 0)
+}
+
+// AddFileWithTabWidth adds a file like AddFile, with tab stops every
+// tabWidth columns. When it is 0, a tab is one column like any other
+// character.
+func (s *FileSet) AddFileWithTabWidth(filename, src string, tabWidth int) *File {
+	f := &File{name: filename, lines: []int{0}, bom: strings.HasPrefix(src, "\uFEFF"), tabWidth: tabWidth}
+	for _, ch := range src {
+		switch {
+		case ch == '\n':
+			f.lines = append(f.lines, f.size+1)
+		case ch == '\t' && tabWidth > 0:
+			f.tabs = append(f.tabs, f.size)
+		}
+		f.size += 1
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f.base = s.base
+	// One more position for the end of the file.
+	s.base += f.size + 1
+	s.files = append(s.files, f)
+	return f
+}
+
+// File returns the file containing p, or nil if there is none.
+func (s *FileSet) File(p Pos) *File {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	i := sort.Search(len(s.files), func(i int) bool { return s.files[i].base > int(p) }) - 1
+	if i < 0 || int(p) > s.files[i].base+s.files[i].size {
+		return nil
+	}
+	return s.files[i]
+}
+
+// Position resolves p. It returns the zero Position if p is in no file.
+func (s *FileSet) Position(p Pos) Position {
+	if f := s.File(p); f != nil {
+		return f.Position(p)
+	}
+	return Position{}
+}
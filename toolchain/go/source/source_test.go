@@ -0,0 +1,76 @@
+package source
+
+import (
+	"testing"
+
+	"github/com/styvane/monkey/lexer"
+	"github/com/styvane/monkey/token"
+)
+
+func TestPosition(t *testing.T) {
+	fset := NewFileSet()
+	a := fset.AddFile("a.mk", "let x = 1;\nlet śń = 2;\n")
+	b := fset.AddFile("b.mk", "x")
+
+	tests := []struct {
+		pos      Pos
+		expected string
+	}{
+		{a.Pos(0), "a.mk:1:1"},
+		{a.Pos(4), "a.mk:1:5"},
+		{a.Pos(10), "a.mk:1:11"},
+		{a.Pos(11), "a.mk:2:1"},
+		{a.Pos(17), "a.mk:2:7"},
+		{a.Pos(a.Size()), "a.mk:3:1"},
+		{b.Pos(0), "b.mk:1:1"},
+		{b.Pos(1), "b.mk:1:2"},
+		{NoPos, "-"},
+		{Pos(b.Base() + 2), "-"},
+	}
+
+	for i, tt := range tests {
+		if got := fset.Position(tt.pos).String(); got != tt.expected {
+			t.Errorf("tests[%d] - Position(%d) wrong. expected=%q, got=%q", i, tt.pos, tt.expected, got)
+		}
+	}
+	if a.LineCount() != 3 || b.LineCount() != 1 {
+		t.Errorf("line counts wrong. expected=3 and 1, got=%d and %d", a.LineCount(), b.LineCount())
+	}
+}
+
+func TestSpanMatchesLexer(t *testing.T) {
+	tests := []struct {
+		src      string
+		tabWidth int
+	}{
+		{"let add = fn(x, y) {\n  x + y;\n};\n\"€${add(1, 2)}\"\n", 0},
+		{"\uFEFFlet x = 1;\nx;", 0},
+		{"\tlet x = 1;\n\t\tx\t+ 1;\na\tb", 0},
+		{"\tlet x = 1;\n\t\tx\t+ 1;\na\tb", 4},
+		{"\uFEFF\tx\t; ab\tc\n\t", 8},
+	}
+
+	for i, tt := range tests {
+		f := NewFileSet().AddFileWithTabWidth("", tt.src, tt.tabWidth)
+		l := lexer.NewWithOptions(tt.src, lexer.Options{TabWidth: tt.tabWidth})
+		for {
+			tok := l.NextToken()
+			if got := f.Span(f.Pos(tok.Offset)); got != tok.Span {
+				t.Errorf("tests[%d] - span of %+v wrong. got=%+v", i, tok, got)
+			}
+			if tok.Kind == token.EOF {
+				break
+			}
+		}
+	}
+}
+
+func TestOffsetOutOfRange(t *testing.T) {
+	f := NewFileSet().AddFile("a.mk", "x")
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("out of range offset did not panic")
+		}
+	}()
+	f.Pos(2)
+}
@@ -0,0 +1,7 @@
+package token
+
+// UnregisterKeyword removes a keyword added by RegisterKeyword, so that
+// tests leave the keyword table as they found it.
+func UnregisterKeyword(name string) {
+	delete(keywords, name)
+}
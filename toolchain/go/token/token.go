@@ -1,13 +1,30 @@
 // Package implements the token data structure and operations.
 package token
 
+import "sort"
+
 const (
-	UNKOWN = "UNKNOWN"
-	EOF    = "EOF"
+	// ILLEGAL is input that cannot start a token. Its literal holds the
+	// offending character, or the whole word for malformed identifiers
+	// like 1x.
+	ILLEGAL = "ILLEGAL"
+	EOF     = "EOF"
+
+	// UNTERMINATED is a string literal that reaches the end of input,
+	// possibly inside an interpolation. It starts at the opening quote
+	// of the outermost string left open and its literal is the raw text
+	// up to the end.
+	UNTERMINATED = "UNTERMINATED"
 
 	// Identifiers and literals
 	IDENT  = "IDENT"  // add, foobar, x, y ...
 	NUMBER = "NUMBER" // 123456
+	STRING = "STRING" // "foo bar"
+
+	// String interpolation: "sum is ${a + b}" lexes as
+	// STRING INTERP_START IDENT PLUS IDENT INTERP_END STRING.
+	INTERP_START = "INTERP_START"
+	INTERP_END   = "INTERP_END"
 
 	// Operators
 	EQ       = "="
@@ -22,14 +39,36 @@ const (
 	EQEQ = "=="
 	NE   = "!="
 
+	POW = "**" // right-associative, binds tighter than *
+
+	// Bitwise operators on integers.
+	BIT_AND = "&"
+	BIT_OR  = "|"
+	BIT_XOR = "^"
+	BIT_NOT = "~"
+	SHL     = "<<"
+	SHR     = ">>"
+
+	PIPE = "|>" // xs |> map(double) is map(xs, double)
+
+	QUESTION = "?"  // hash?["key"]
+	COALESCE = "??" // a ?? b
+	ARROW    = "=>" // match arm: 1 => "one"
+
+	// Type annotations: let x: int = 5; fn(x: int) -> int { x }.
+	COLON      = ":"
+	THIN_ARROW = "->"
+
 	COMMA = ","
 	SEMI  = ";"
+	RANGE = ".." // 1..10
+	DOT   = "."  // field access: p.x
 
 	// Delimiters
 	LPAREN   = "("
 	RPAREN   = ")"
 	LBRACE   = "{"
-	RBRACE   = "{"
+	RBRACE   = "}"
 	LBRACKET = "["
 	RBRACKET = "]"
 
@@ -41,6 +80,10 @@ const (
 	TRUE     = "TRUE"
 	FALSE    = "FALSE"
 	RETURN   = "RETURN"
+	NULL     = "NULL"
+	MATCH    = "MATCH"
+	FOR      = "FOR" // for (x in xs) { ... }
+	IN       = "IN"
 )
 
 // Keywords table.
@@ -52,6 +95,41 @@ var keywords = map[string]Kind{
 	"return": RETURN,
 	"true":   TRUE,
 	"false":  FALSE,
+	"null":   NULL,
+	"match":  MATCH,
+	"for":    FOR,
+	"in":     IN,
+}
+
+// RegisterKeyword adds a keyword lexing to kind, so that embedders can
+// extend the language with keywords of their own. It panics if name is
+// already a keyword. It is meant to be called from init functions: it
+// must not run concurrently with lexing.
+func RegisterKeyword(name string, kind Kind) {
+	if _, ok := keywords[name]; ok {
+		panic("token: keyword " + name + " already registered")
+	}
+	keywords[name] = kind
+}
+
+// Keywords returns the language keywords in sorted order.
+func Keywords() []string {
+	words := make([]string, 0, len(keywords))
+	for word := range keywords {
+		words = append(words, word)
+	}
+	sort.Strings(words)
+	return words
+}
+
+// IsKeyword returns true if kind is the kind of a keyword.
+func IsKeyword(kind Kind) bool {
+	for _, k := range keywords {
+		if k == kind {
+			return true
+		}
+	}
+	return false
 }
 
 // The Token type represents a lexical token.
@@ -59,19 +137,24 @@ type Token struct {
 	Kind    Kind
 	Literal string
 	Span
+	// Doc is the text of the /// doc comments right before the token,
+	// without the slashes, one line per comment.
+	Doc string
 }
 
 // Span represents a region of code.
 type Span struct {
-	// Lineno is the line number in the input.
+	// Lineno is the line number in the input, from 1.
 	Lineno int
-	// ColumnPos is the postion in the input.
+	// LineColumn is the column in the line, from 1, counting runes.
 	LineColumn int
+	// Offset is the position in the input, counting runes from 0.
+	Offset int
 }
 
-// NewSpan creates a new span with the line number and position.
-func NewSpan(lineno, lineColumn int) Span {
-	return Span{Lineno: lineno, LineColumn: lineColumn}
+// NewSpan creates a new span with the line number, column and offset.
+func NewSpan(lineno, lineColumn, offset int) Span {
+	return Span{Lineno: lineno, LineColumn: lineColumn, Offset: offset}
 }
 
 // Kind represents the type of a token.
@@ -109,11 +192,44 @@ func LookupOp(ch rune) Kind {
 		return LT
 	case '>':
 		return GT
+	case '?':
+		return QUESTION
+	case '&':
+		return BIT_AND
+	case '|':
+		return BIT_OR
+	case '^':
+		return BIT_XOR
+	case '~':
+		return BIT_NOT
 	default:
-		return UNKOWN
+		return ILLEGAL
 	}
 }
 
+// Two-character operators.
+var doubleOps = map[string]Kind{
+	"==": EQEQ,
+	"!=": NE,
+	"=>": ARROW,
+	"??": COALESCE,
+	"**": POW,
+	"->": THIN_ARROW,
+	"|>": PIPE,
+	"<<": SHL,
+	">>": SHR,
+	// Reserved for logical operators, so that a && b is rejected rather
+	// than read as a & &b.
+	"&&": ILLEGAL,
+	"||": ILLEGAL,
+}
+
+// LookupDoubleOp lookup a two-character operator.
+func LookupDoubleOp(op string) (Kind, bool) {
+	kind, ok := doubleOps[op]
+	return kind, ok
+}
+
 // LookupDelimiter lookup a delimiter.
 func LookupDelimiter(ch rune) Kind {
 	switch ch {
@@ -130,6 +246,6 @@ func LookupDelimiter(ch rune) Kind {
 	case ']':
 		return RBRACKET
 	default:
-		return UNKOWN
+		return ILLEGAL
 	}
 }
@@ -0,0 +1,53 @@
+package token_test
+
+import (
+	"testing"
+
+	"github/com/styvane/monkey/token"
+)
+
+func TestRegisterKeyword(t *testing.T) {
+	const RULE token.Kind = "RULE"
+	token.RegisterKeyword("rule", RULE)
+	t.Cleanup(func() { token.UnregisterKeyword("rule") })
+
+	tests := []struct {
+		ident    string
+		expected token.Kind
+	}{
+		{"rule", RULE},
+		{"ruler", token.IDENT},
+		{"let", token.LET},
+	}
+	for i, tt := range tests {
+		if got := token.LookupIdent(tt.ident); got != tt.expected {
+			t.Errorf("tests[%d] - LookupIdent(%q) wrong. expected=%q, got=%q", i, tt.ident, tt.expected, got)
+		}
+	}
+	if !token.IsKeyword(RULE) {
+		t.Errorf("IsKeyword(%q) wrong. expected=true", RULE)
+	}
+}
+
+func TestRegisterExistingKeyword(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("registering an existing keyword did not panic")
+		}
+	}()
+	token.RegisterKeyword("let", "RULE")
+}
+
+func TestKeywords(t *testing.T) {
+	words := token.Keywords()
+	for i := 1; i < len(words); i++ {
+		if words[i-1] >= words[i] {
+			t.Fatalf("keywords not sorted: %q before %q", words[i-1], words[i])
+		}
+	}
+	for _, word := range words {
+		if !token.IsKeyword(token.LookupIdent(word)) {
+			t.Errorf("keyword %q does not look up to a keyword kind", word)
+		}
+	}
+}